@@ -0,0 +1,202 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xyproto/vt"
+	"golang.org/x/net/http2"
+)
+
+// The number of rows in the latency histogram
+const histogramBuckets = 10
+
+// The widest a histogram bar can be, in characters
+const histogramWidth = 40
+
+// benchResult is the outcome of a single request during a benchmark
+type benchResult struct {
+	latency time.Duration
+	bytes   int64
+	err     error
+}
+
+// Run the "bench" subcommand, which sends many requests over a configurable
+// number of HTTP/2 connections and reports throughput and latency.
+func runBench(o *vt.TextOutput, args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+
+	connectionsHelp := "Number of HTTP/2 connections"
+	streamsHelp := "Number of concurrent streams per connection"
+	requestsHelp := "Total number of requests"
+
+	connections := fs.Int("c", 1, connectionsHelp)
+	streams := fs.Int("m", 10, streamsHelp)
+	requests := fs.Int("n", 100, requestsHelp)
+
+	fs.Usage = func() {
+		fmt.Println()
+		fmt.Println("Syntax: http2check bench [flags] [URI]")
+		fmt.Println()
+		fmt.Println("Possible flags:")
+		fmt.Println("    -c N                       " + connectionsHelp)
+		fmt.Println("    -m N                       " + streamsHelp)
+		fmt.Println("    -n N                       " + requestsHelp)
+		fmt.Println()
+	}
+
+	fs.Parse(args)
+
+	if *connections < 1 || *streams < 1 || *requests < 1 {
+		o.ErrExit("-c, -m and -n must all be at least 1")
+	}
+
+	url := "https://twitter.com"
+	if fs.NArg() > 0 {
+		url = fs.Arg(0)
+	}
+	url = prepareURL(o, url)
+
+	o.Println(fmt.Sprintf("%s %s %s", vt.DarkGray.Get("BENCH"), vt.LightCyan.Get(url), vt.DarkGray.Get(fmt.Sprintf("(%d connections, %d streams each, %d requests)", *connections, *streams, *requests))))
+
+	// One transport per connection, so that each transport keeps a single
+	// connection open and multiplexes its streams over it.
+	transports := make([]*http2.Transport, *connections)
+	for i := range transports {
+		transports[i] = newTransport()
+		transports[i].StrictMaxConcurrentStreams = true
+	}
+
+	jobs := make(chan struct{}, *requests)
+	for i := 0; i < *requests; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+
+	results := make(chan benchResult, *requests)
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for c := 0; c < *connections; c++ {
+		for m := 0; m < *streams; m++ {
+			wg.Add(1)
+			go func(rt *http2.Transport) {
+				defer wg.Done()
+				for range jobs {
+					results <- benchRequest(rt, url)
+				}
+			}(transports[c])
+		}
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	close(results)
+
+	for _, rt := range transports {
+		rt.CloseIdleConnections()
+	}
+
+	var (
+		latencies []time.Duration
+		total     int64
+		failures  int
+		lastErr   error
+	)
+	for r := range results {
+		if r.err != nil {
+			failures++
+			lastErr = r.err
+			continue
+		}
+		latencies = append(latencies, r.latency)
+		total += r.bytes
+	}
+
+	seconds := elapsed.Seconds()
+	msg(o, "time", vt.White.Get(elapsed.Round(time.Millisecond).String()))
+	msg(o, "requests", vt.White.Get(fmt.Sprintf("%d succeeded, %d failed", len(latencies), failures)))
+	if lastErr != nil {
+		msg(o, "error", vt.Red.Get(strings.TrimSpace(lastErr.Error())))
+	}
+	if len(latencies) == 0 {
+		os.Exit(1)
+	}
+	msg(o, "req/s", vt.White.Get(fmt.Sprintf("%.2f", float64(len(latencies))/seconds)))
+	msg(o, "bytes/s", vt.White.Get(fmt.Sprintf("%.0f", float64(total)/seconds)))
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	for _, p := range []int{50, 90, 99} {
+		msg(o, fmt.Sprintf("p%d", p), vt.White.Get(percentile(latencies, p).String()))
+	}
+	msg(o, "max", vt.White.Get(latencies[len(latencies)-1].String()))
+
+	o.Println()
+	printHistogram(o, latencies)
+}
+
+// Send one GET request and read the full body
+func benchRequest(rt *http2.Transport, url string) benchResult {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return benchResult{err: err}
+	}
+	start := time.Now()
+	res, err := rt.RoundTrip(req)
+	if err != nil {
+		return benchResult{err: err}
+	}
+	defer res.Body.Close()
+	n, err := io.Copy(io.Discard, res.Body)
+	return benchResult{latency: time.Since(start), bytes: n, err: err}
+}
+
+// Return the p-th percentile of the given sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// Draw a latency histogram, from the fastest to the slowest request
+func printHistogram(o *vt.TextOutput, sorted []time.Duration) {
+	lo, hi := sorted[0], sorted[len(sorted)-1]
+	step := (hi - lo) / histogramBuckets
+	if step <= 0 {
+		step = 1
+	}
+	counts := make([]int, histogramBuckets)
+	for _, d := range sorted {
+		i := int((d - lo) / step)
+		if i >= histogramBuckets {
+			i = histogramBuckets - 1
+		}
+		counts[i]++
+	}
+	highest := 0
+	for _, c := range counts {
+		if c > highest {
+			highest = c
+		}
+	}
+	for i, c := range counts {
+		from := (lo + time.Duration(i)*step).Round(time.Microsecond)
+		bar := strings.Repeat("#", c*histogramWidth/highest)
+		color := vt.LightGreen
+		switch {
+		case i >= histogramBuckets*8/10:
+			color = vt.Red
+		case i >= histogramBuckets/2:
+			color = vt.LightYellow
+		}
+		o.Println(fmt.Sprintf("%12s %s %s", from, vt.DarkGray.Get("|"), color.Get(bar)) + " " + vt.DarkGray.Get(fmt.Sprintf("%d", c)))
+	}
+}
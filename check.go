@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"time"
+
+	"github.com/xyproto/vt"
+	"golang.org/x/net/http2/hpack"
+)
+
+// Error classes, for telling different kinds of failures apart
+const (
+	classDNS     = "dns"
+	classConnect = "connect"
+	classTLS     = "tls"
+	classNoH2    = "no-h2"
+	classTimeout = "timeout"
+	classOther   = "error"
+)
+
+// Exit codes, so that scripts can tell the different outcomes apart
+const (
+	exitOK        = 0
+	exitError     = 1 // any other error
+	exitUsage     = 2 // invalid flags or flag values
+	exitDNS       = 3 // the host name could not be resolved
+	exitConnect   = 4 // the TCP connection failed
+	exitTLS       = 5 // the TLS handshake failed
+	exitNoH2      = 6 // the server does not support HTTP/2
+	exitAssertion = 7 // the server responded, but not as expected
+	exitTimeout   = 8 // the check took too long
+)
+
+// The exit code for each error class
+var classExitCodes = map[string]int{
+	classDNS:     exitDNS,
+	classConnect: exitConnect,
+	classTLS:     exitTLS,
+	classNoH2:    exitNoH2,
+	classTimeout: exitTimeout,
+	classOther:   exitError,
+}
+
+// checkResult is the outcome of checking if a server supports HTTP/2
+type checkResult struct {
+	URL          string `json:"url"`
+	IPv6         bool   `json:"ipv6,omitempty"`   // true if the URL had to be rewritten as an IPv6 address
+	Proto        string `json:"proto,omitempty"`  // for example "HTTP/2.0"
+	Status       string `json:"status,omitempty"` // for example "200 OK"
+	StatusCode   int    `json:"status_code,omitempty"`
+	TLSVersion   string `json:"tls_version,omitempty"`    // for example "TLS 1.3"
+	TLSVersionID uint16 `json:"tls_version_id,omitempty"` // the TLS version number, for comparisons, for example 0x0304
+	Class        string `json:"class,omitempty"`          // the error class, empty if there was no error
+	Subject      string `json:"subject,omitempty"`        // what the error is about, for example "host"
+	Message      string `json:"message,omitempty"`        // a short description of the error, for example "Down"
+	Extra        string `json:"extra,omitempty"`          // additional information about the error
+
+	CertExpiry time.Time `json:"cert_expiry,omitzero"`  // when the server certificate expires
+	CertError  string    `json:"cert_error,omitempty"`  // why the certificate is not valid for the host, if it is not
+	CertSHA256 string    `json:"cert_sha256,omitempty"` // the fingerprint of the server certificate
+	CertName   string    `json:"cert_name,omitempty"`   // the common name of the server certificate, or the first DNS name
+	Timings    timings   `json:"timings"`
+
+	Started    time.Time `json:"started,omitzero"`
+	ServerIP   string    `json:"server_ip,omitempty"`  // the address that was connected to
+	Connection string    `json:"connection,omitempty"` // the local address of the connection, which identifies it
+
+	requestHeaders  []hpack.HeaderField // the request header fields, as they were written
+	responseHeaders http.Header
+	contentLength   int64 // the length of the response body, or -1 if unknown
+}
+
+// timings are the durations of each phase of a check
+type timings struct {
+	DNS        time.Duration `json:"dns"`        // resolving the host name
+	Connect    time.Duration `json:"connect"`    // establishing the TCP connection
+	TLS        time.Duration `json:"tls"`        // the TLS handshake
+	Processing time.Duration `json:"processing"` // from the request is sent until the first response byte
+	Total      time.Duration `json:"total"`      // the entire check
+}
+
+// Return a client trace that records the phase timings of a request in t
+func (t *timings) trace() *httptrace.ClientTrace {
+	var dnsStart, connectStart, connectDone, wroteRequest time.Time
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.DNS = time.Since(dnsStart) },
+		ConnectStart: func(_, _ string) {
+			connectStart = time.Now()
+		},
+		ConnectDone: func(_, _ string, _ error) {
+			connectDone = time.Now()
+			t.Connect = connectDone.Sub(connectStart)
+		},
+		// The HTTP/2 transport has no TLS hooks, but the handshake is
+		// done right after connecting and before the connection is ready
+		GotConn: func(httptrace.GotConnInfo) {
+			if !connectDone.IsZero() {
+				t.TLS = time.Since(connectDone)
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { wroteRequest = time.Now() },
+		GotFirstResponseByte: func() {
+			if !wroteRequest.IsZero() {
+				t.Processing = time.Since(wroteRequest)
+			}
+		},
+	}
+}
+
+// Classify the given error and return the error class, what the error is
+// about, a short description and optionally additional information
+func classifyError(err error) (class, subject, message, extra string) {
+	errorMessage := strings.TrimSpace(err.Error())
+	var (
+		netErr net.Error
+		dnsErr *net.DNSError
+		opErr  *net.OpError
+	)
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return classTimeout, "host", "Timeout", errorMessage
+	}
+	switch {
+	case errorMessage == "bad protocol:":
+		return classNoH2, "protocol", "Not HTTP/2", ""
+	case errorMessage == "http2: unsupported scheme and no Fallback", errorMessage == "http2: unencrypted HTTP/2 not enabled":
+		return classNoH2, "HTTP/2", "Not supported", ""
+	case strings.HasPrefix(errorMessage, "tls: oversized record received with length "):
+		return classTLS, "protocol", "No HTTPS support", errorMessage
+	case strings.HasPrefix(errorMessage, "http2: unexpected ALPN protocol"), strings.HasSuffix(errorMessage, "tls: no application protocol"):
+		return classNoH2, "protocol", "Not HTTP/2", ""
+	case errors.As(err, &dnsErr):
+		return classDNS, "host", "Down", "host not found"
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		// Connecting failed, over TCP or to a Unix domain socket
+		return classConnect, "host", "Down", errorMessage
+	case strings.Contains(errorMessage, "tls: "), strings.HasPrefix(errorMessage, "x509: "):
+		return classTLS, "TLS", "Handshake failed", errorMessage
+	}
+	return classOther, "error", errorMessage, ""
+}
+
+// Record the given error in the result
+func (r *checkResult) setError(err error) {
+	r.Class, r.Subject, r.Message, r.Extra = classifyError(err)
+}
+
+// Check if the certificates the server sent are valid for the given host,
+// and return an error describing why if they are not
+func verifyCert(state *tls.ConnectionState, host string) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("no certificate")
+	}
+	opts := x509.VerifyOptions{DNSName: host, Intermediates: x509.NewCertPool()}
+	for _, cert := range state.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// Check if the server at the given URL supports HTTP/2, by sending a GET request
+func check(ctx context.Context, url string) *checkResult {
+	return checkRequest(ctx, "GET", url, nil)
+}
+
+// Check if the server at the given URL supports HTTP/2, by sending a
+// request with the given method and headers
+func checkRequest(ctx context.Context, method, url string, header http.Header) *checkResult {
+	r := &checkResult{URL: url}
+	r.Started = time.Now()
+	defer func() { r.Timings.Total = time.Since(r.Started) }()
+	ctx = httptrace.WithClientTrace(ctx, r.Timings.trace())
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if addr, ok := info.Conn.RemoteAddr().(*net.TCPAddr); ok {
+				r.ServerIP = addr.IP.String()
+			}
+			r.Connection = info.Conn.LocalAddr().String()
+		},
+		WroteHeaderField: func(name string, values []string) {
+			for _, v := range values {
+				r.requestHeaders = append(r.requestHeaders, hpack.HeaderField{Name: name, Value: v})
+			}
+		},
+	})
+
+	newRequest := func(url string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, url, nil)
+		if err == nil {
+			for k, v := range header {
+				req.Header[k] = v
+			}
+			req.Host = header.Get("Host")
+			if hostHeader != "" {
+				req.Host = hostHeader
+			}
+		}
+		return req, err
+	}
+
+	req, err := newRequest(url)
+	if err != nil && strings.HasSuffix(err.Error(), "hexadecimal escape in host") {
+		r.URL = fixIPv6(url)
+		req, err = newRequest(r.URL)
+	}
+	if err != nil {
+		r.setError(err)
+		return r
+	}
+
+	// GET over HTTP/2
+	rt := newTransport()
+	if req.URL.Scheme == "http" && unixSocket != "" {
+		// Unix domain sockets are usually served with h2c
+		rt = newH2CTransport()
+	}
+	defer rt.CloseIdleConnections()
+	res, err := rt.RoundTrip(req)
+	if err != nil {
+		// Pick up typical problems with IPv6 addresses
+		// TODO: Find an exact way to do this instead
+		if strings.Contains(err.Error(), "too many colons") {
+			r.URL = fixIPv6(r.URL)
+			r.IPv6 = true
+			req, err = newRequest(r.URL)
+			if err != nil {
+				r.setError(err)
+				return r
+			}
+			res, err = rt.RoundTrip(req)
+		}
+		if err != nil {
+			r.setError(err)
+			return r
+		}
+	}
+	res.Body.Close()
+
+	r.Proto = res.Proto
+	r.Status = res.Status
+	r.StatusCode = res.StatusCode
+	r.responseHeaders = res.Header
+	r.contentLength = res.ContentLength
+	if res.TLS != nil {
+		r.TLSVersion = tls.VersionName(res.TLS.Version)
+		r.TLSVersionID = res.TLS.Version
+		if len(res.TLS.PeerCertificates) > 0 {
+			r.CertExpiry = res.TLS.PeerCertificates[0].NotAfter
+			r.CertSHA256 = fmt.Sprintf("%x", sha256.Sum256(res.TLS.PeerCertificates[0].Raw))
+			r.CertName = res.TLS.PeerCertificates[0].Subject.CommonName
+			if r.CertName == "" && len(res.TLS.PeerCertificates[0].DNSNames) > 0 {
+				r.CertName = res.TLS.PeerCertificates[0].DNSNames[0]
+			}
+		}
+		name := req.URL.Hostname()
+		if sniName != "" {
+			name = sniName
+		}
+		if err := verifyCert(res.TLS, name); err != nil {
+			r.CertError = err.Error()
+		}
+	}
+	return r
+}
+
+// Return true if the check succeeded
+func (r *checkResult) ok() bool {
+	return r.Class == ""
+}
+
+// Return a one line summary of the outcome
+func (r *checkResult) summary() string {
+	if !r.ok() {
+		s := r.Class + ": " + r.Subject + " " + r.Message
+		if r.Extra != "" {
+			s += " (" + r.Extra + ")"
+		}
+		return s
+	}
+	s := r.Proto + ", " + r.Status
+	if r.TLSVersion != "" {
+		s += ", " + r.TLSVersion
+	}
+	return s
+}
+
+// Return the exit code for the outcome of a check, given if all the
+// assertions passed
+func exitCode(r *checkResult, passed bool) int {
+	if !r.ok() {
+		return classExitCodes[r.Class]
+	}
+	if !passed {
+		return exitAssertion
+	}
+	return exitOK
+}
+
+// Print the outcome of a check
+func printResult(o *vt.TextOutput, r *checkResult) {
+	if r.IPv6 {
+		o.Println(vt.LightYellow.Get("IPv6") + " " + vt.DarkGray.Get(r.URL))
+	}
+	switch {
+	case r.ok():
+		msg(o, "protocol", vt.White.Get(r.Proto))
+		msg(o, "status", vt.White.Get(r.Status))
+	case r.Class == classOther:
+		o.Err(r.Message)
+	case r.Extra != "":
+		msg(o, r.Subject, vt.Red.Get(r.Message), r.Extra)
+	default:
+		msg(o, r.Subject, vt.Red.Get(r.Message))
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/vt"
+)
+
+// The largest number of addresses that a CIDR range may expand to
+const maxCIDRAddresses = 1 << 16
+
+// Parse a target like "10.20.0.0/24:443" or "[fd00::]/120:8443". The port
+// is 443 if none is given. Returns false if the target is not a CIDR range.
+func parseCIDRTarget(s string) (*net.IPNet, int, bool, error) {
+	prefix, rest, found := strings.Cut(s, "/")
+	if !found || strings.Contains(prefix, "://") {
+		return nil, 0, false, nil
+	}
+	prefix = strings.TrimSuffix(strings.TrimPrefix(prefix, "["), "]")
+	if net.ParseIP(prefix) == nil {
+		return nil, 0, false, nil
+	}
+	bits, portString, hasPort := strings.Cut(rest, ":")
+	// Targets like 1.2.3.4/index.html are URLs, not CIDR ranges
+	if !isDigits(bits) {
+		return nil, 0, false, nil
+	}
+	port := 443
+	if hasPort {
+		p, err := strconv.Atoi(portString)
+		if err != nil || p < 1 || p > 65535 {
+			return nil, 0, true, fmt.Errorf("invalid port: %s", portString)
+		}
+		port = p
+	}
+	_, network, err := net.ParseCIDR(prefix + "/" + bits)
+	if err != nil {
+		return nil, 0, true, err
+	}
+	return network, port, true, nil
+}
+
+// Check if the string is non-empty and only has the digits 0 to 9
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Return all the addresses in the network. For IPv4 networks that are
+// larger than /31, the network and broadcast addresses are left out.
+func cidrAddresses(network *net.IPNet) ([]string, error) {
+	ones, size := network.Mask.Size()
+	if size-ones > 16 {
+		return nil, fmt.Errorf("%s is too large, the maximum is %d addresses", network, maxCIDRAddresses)
+	}
+	ip := network.IP.Mask(network.Mask)
+	var addresses []string
+	for ; network.Contains(ip); ip = nextIP(ip) {
+		addresses = append(addresses, ip.String())
+	}
+	if ip.To4() != nil && size-ones > 1 {
+		addresses = addresses[1 : len(addresses)-1]
+	}
+	return addresses, nil
+}
+
+// Return the address that comes after the given one
+func nextIP(ip net.IP) net.IP {
+	next := append(net.IP(nil), ip...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// Check every address in a CIDR range for TLS and HTTP/2, with the given
+// SNI name, and print the addresses that answered and a summary
+func runCIDR(o *vt.TextOutput, network *net.IPNet, port int, sni string, concurrency int) {
+	addresses, err := cidrAddresses(network)
+	if err != nil {
+		usageExit(o, err.Error())
+	}
+	info := fmt.Sprintf("(%d addresses, port %d", len(addresses), port)
+	if sni != "" {
+		info += ", SNI " + sni
+	}
+	o.Println(vt.DarkGray.Get("SCAN") + " " + vt.LightCyan.Get(network.String()) + " " + vt.DarkGray.Get(info+")"))
+
+	var targets []portTarget
+	for _, a := range addresses {
+		targets = append(targets, portTarget{a, port})
+	}
+	results := probeAll(targets, sni, concurrency)
+
+	table := &portTable{o: o, width: len("address")}
+	for _, a := range addresses {
+		table.width = max(table.width, len(a))
+	}
+	answered, negotiatedTLS, negotiatedH2 := 0, 0, 0
+	for i, pr := range results {
+		if !pr.open {
+			continue
+		}
+		if answered == 0 {
+			o.Println()
+			table.header("address")
+		}
+		answered++
+		if pr.tlsVersion != "" {
+			negotiatedTLS++
+		}
+		if pr.alpn == "h2" {
+			negotiatedH2++
+		}
+		table.result(addresses[i], pr, "")
+	}
+	o.Println()
+	msg(o, "addresses", vt.White.Get(fmt.Sprintf("%d answered", answered)), fmt.Sprintf("of %d", len(addresses)))
+	msg(o, "TLS", vt.White.Get(fmt.Sprintf("%d negotiated", negotiatedTLS)))
+	if negotiatedH2 > 0 {
+		msg(o, "HTTP/2", vt.LightGreen.Get(fmt.Sprintf("%d negotiated", negotiatedH2)))
+	} else {
+		msg(o, "HTTP/2", vt.LightYellow.Get("none negotiated"))
+	}
+}
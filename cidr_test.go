@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestParseCIDRTarget(t *testing.T) {
+	tests := []struct {
+		target  string
+		isCIDR  bool
+		network string
+		port    int
+	}{
+		{"1.2.3.4/path", false, "", 0},
+		{"1.2.3.4/index.html", false, "", 0},
+		{"example.com/24", false, "", 0},
+		{"https://10.0.0.0/24", false, "", 0},
+		{"10.0.0.0/24", true, "10.0.0.0/24", 443},
+		{"10.0.0.0/24:8443", true, "10.0.0.0/24", 8443},
+		{"[fd00::]/120:443", true, "fd00::/120", 443},
+	}
+	for _, tt := range tests {
+		network, port, isCIDR, err := parseCIDRTarget(tt.target)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.target, err)
+			continue
+		}
+		if isCIDR != tt.isCIDR {
+			t.Errorf("%s: got isCIDR %v, want %v", tt.target, isCIDR, tt.isCIDR)
+			continue
+		}
+		if !isCIDR {
+			continue
+		}
+		if network.String() != tt.network || port != tt.port {
+			t.Errorf("%s: got %s port %d, want %s port %d", tt.target, network, port, tt.network, tt.port)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xyproto/vt"
+)
+
+// countingConn is a net.Conn that adds the number of bytes read and written to a counter
+type countingConn struct {
+	net.Conn
+	n *int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+// connStats keeps track of the connections dialed by one transport
+type connStats struct {
+	conns int64 // number of connections
+	wire  int64 // bytes on the wire, including the TLS handshake and records
+	plain int64 // decrypted bytes, including headers and framing
+	body  int64 // response body bytes
+	took  time.Duration
+}
+
+// Dial a TLS connection with the given config, counting bytes both below and
+// above TLS. If proto is not empty, it must be negotiated with ALPN.
+func (s *connStats) dialTLS(ctx context.Context, network, addr string, cfg *tls.Config, proto string) (net.Conn, error) {
+	var d net.Dialer
+	raw, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&s.conns, 1)
+	tc := tls.Client(&countingConn{raw, &s.wire}, cfg)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	if proto != "" {
+		if err := checkALPN(tc, proto); err != nil {
+			raw.Close()
+			return nil, err
+		}
+	}
+	return &countingConn{tc, &s.plain}, nil
+}
+
+// headerBytes returns the number of bytes that were not response body,
+// which is headers plus protocol framing
+func (s *connStats) headerBytes() int64 {
+	return s.plain - s.body
+}
+
+// Fetch all the given URLs concurrently with the given round tripper
+func (s *connStats) fetchAll(rt http.RoundTripper, urls []string) error {
+	var (
+		wg       sync.WaitGroup
+		mut      sync.Mutex
+		firstErr error
+	)
+	start := time.Now()
+	for _, u := range urls {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			n, err := fetch(rt, u)
+			atomic.AddInt64(&s.body, n)
+			if err != nil {
+				mut.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mut.Unlock()
+			}
+		}(u)
+	}
+	wg.Wait()
+	s.took = time.Since(start)
+	return firstErr
+}
+
+// GET the given URL and discard the body, returning the number of body bytes
+func fetch(rt http.RoundTripper, url string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := rt.RoundTrip(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	return io.Copy(io.Discard, res.Body)
+}
+
+// Print why fetching over the given protocol failed, and exit with the same
+// exit code as a regular check would
+func compareFailed(o *vt.TextOutput, proto string, err error) {
+	r := &checkResult{}
+	r.setError(err)
+	o.Err(proto + ": " + r.summary())
+	os.Exit(exitCode(r, true))
+}
+
+// Fetch the given paths over a pool of HTTP/1.1 connections and then over a
+// single multiplexed HTTP/2 connection, and print the results side by side.
+func runCompare(o *vt.TextOutput, url string, paths []string, conns int) {
+	base, err := neturl.Parse(url)
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	if base.Scheme != "https" {
+		o.ErrExit("--compare requires an https:// URL")
+	}
+	var urls []string
+	for _, p := range paths {
+		ref, err := neturl.Parse(strings.TrimSpace(p))
+		if err != nil {
+			o.ErrExit(err.Error())
+		}
+		urls = append(urls, base.ResolveReference(ref).String())
+	}
+
+	o.Println(fmt.Sprintf("%s %s %s", vt.DarkGray.Get("COMPARE"), vt.LightCyan.Get(url), vt.DarkGray.Get(fmt.Sprintf("(%d paths, %d HTTP/1.1 connections)", len(urls), conns))))
+
+	// HTTP/1.1, with up to conns connections
+	var h1 connStats
+	h1rt := &http.Transport{
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, _, _ := net.SplitHostPort(addr)
+			cfg := newTLSConfig(host, "http/1.1")
+			return h1.dialTLS(ctx, network, addr, cfg, "")
+		},
+		MaxConnsPerHost:     conns,
+		MaxIdleConnsPerHost: conns,
+	}
+	if err := h1.fetchAll(h1rt, urls); err != nil {
+		compareFailed(o, "HTTP/1.1", err)
+	}
+	h1rt.CloseIdleConnections()
+
+	// HTTP/2, multiplexed over a single connection
+	var h2 connStats
+	h2rt := newTransport()
+	h2rt.StrictMaxConcurrentStreams = true
+	h2rt.DialTLSContext = func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+		return h2.dialTLS(ctx, network, addr, cfg, "h2")
+	}
+	if err := h2.fetchAll(h2rt, urls); err != nil {
+		compareFailed(o, "HTTP/2", err)
+	}
+	h2rt.CloseIdleConnections()
+
+	row := func(name, a, b string) {
+		o.Println(fmt.Sprintf("%-16s %16s %16s", name, a, b))
+	}
+	o.Println()
+	o.Println(vt.DarkGray.Get(fmt.Sprintf("%-16s %16s %16s", "", "HTTP/1.1", "HTTP/2")))
+	row("total time", h1.took.Round(time.Millisecond).String(), h2.took.Round(time.Millisecond).String())
+	row("connections", fmt.Sprint(h1.conns), fmt.Sprint(h2.conns))
+	row("bytes on wire", fmt.Sprint(h1.wire), fmt.Sprint(h2.wire))
+	row("body bytes", fmt.Sprint(h1.body), fmt.Sprint(h2.body))
+	row("header bytes", fmt.Sprint(h1.headerBytes()), fmt.Sprint(h2.headerBytes()))
+	o.Println()
+
+	saved := h1.headerBytes() - h2.headerBytes()
+	if h1.headerBytes() > 0 && saved > 0 {
+		msg(o, "saved", vt.LightGreen.Get(fmt.Sprintf("%d header bytes", saved)), fmt.Sprintf("%.1f%%", 100*float64(saved)/float64(h1.headerBytes())))
+	} else {
+		msg(o, "saved", vt.LightYellow.Get("no header bytes"))
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xyproto/env/v2"
+	"github.com/xyproto/vt"
+)
+
+// The timeout for a check when none is configured
+const defaultTimeout = 10 * time.Second
+
+// configEntry is one section of a configuration file, before it is interpreted
+type configEntry struct {
+	values  map[string]string
+	headers map[string]string
+	line    int // where the entry starts, for error messages
+}
+
+func newConfigEntry(line int) *configEntry {
+	return &configEntry{values: make(map[string]string), headers: make(map[string]string), line: line}
+}
+
+// rawConfig is a configuration file with global defaults and a list of checks
+type rawConfig struct {
+	defaults *configEntry
+	checks   []*configEntry
+}
+
+// target is a URL to check, together with how to check it and what to expect
+type target struct {
+	URL     string
+	Method  string
+	Headers http.Header
+	Timeout time.Duration
+	Expect  expectations
+}
+
+// Remove a trailing comment that starts with #, unless the # is quoted
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// Remove surrounding quotes from a value, if there are any
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		if s[0] == '"' {
+			if u, err := strconv.Unquote(s); err == nil {
+				return u
+			}
+		}
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Parse the subset of YAML that is used for configuration files:
+//
+//	defaults:
+//	  timeout: 10s
+//	  headers:
+//	    user-agent: http2check
+//	checks:
+//	  - url: https://example.com
+//	    expect_status: 2xx
+//
+// The list items may also start at the beginning of the line.
+func parseYAMLConfig(data string) (*rawConfig, error) {
+	cfg := &rawConfig{defaults: newConfigEntry(1)}
+	var (
+		section       string
+		entry         *configEntry
+		headersIndent = -1 // the indentation of "headers:", or -1 when not in a headers block
+	)
+	for i, line := range strings.Split(data, "\n") {
+		n := i + 1
+		line = strings.TrimRight(stripComment(line), " \t\r")
+		text := strings.TrimSpace(line)
+		if text == "" || text == "---" {
+			continue
+		}
+		if strings.Contains(line, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", n)
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		listItem := text == "-" || strings.HasPrefix(text, "- ")
+		// The items of a list may be indented as much as the key of the list
+		if indent == 0 && !listItem {
+			section, entry, headersIndent = strings.TrimSuffix(text, ":"), nil, -1
+			switch section {
+			case "defaults":
+				entry = cfg.defaults
+			case "checks":
+			default:
+				return nil, fmt.Errorf("line %d: unknown section %q", n, section)
+			}
+			continue
+		}
+		if listItem {
+			if section != "checks" {
+				return nil, fmt.Errorf("line %d: list items are only allowed in checks", n)
+			}
+			entry, headersIndent = newConfigEntry(n), -1
+			cfg.checks = append(cfg.checks, entry)
+			// The key after the dash lines up with the keys below it
+			text = strings.TrimSpace(text[1:])
+			indent += 2
+			if text == "" {
+				continue
+			}
+		}
+		if entry == nil {
+			return nil, fmt.Errorf("line %d: expected a list item", n)
+		}
+		key, value, found := strings.Cut(text, ":")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected key: value", n)
+		}
+		key, value = strings.TrimSpace(key), unquote(value)
+		if headersIndent >= 0 && indent > headersIndent {
+			entry.headers[key] = value
+			continue
+		}
+		headersIndent = -1
+		if key == "headers" && value == "" {
+			headersIndent = indent
+			continue
+		}
+		entry.values[key] = value
+	}
+	return cfg, nil
+}
+
+// Parse the subset of TOML that is used for configuration files:
+//
+//	[defaults]
+//	timeout = "10s"
+//
+//	[defaults.headers]
+//	user-agent = "http2check"
+//
+//	[[checks]]
+//	url = "https://example.com"
+//	expect_status = "2xx"
+func parseTOMLConfig(data string) (*rawConfig, error) {
+	cfg := &rawConfig{defaults: newConfigEntry(1)}
+	var (
+		entry   *configEntry
+		headers bool // true if the current table is a headers table
+	)
+	for i, line := range strings.Split(data, "\n") {
+		n := i + 1
+		text := strings.TrimSpace(stripComment(line))
+		if text == "" {
+			continue
+		}
+		switch text {
+		case "[defaults]":
+			entry, headers = cfg.defaults, false
+			continue
+		case "[defaults.headers]":
+			entry, headers = cfg.defaults, true
+			continue
+		case "[[checks]]":
+			entry, headers = newConfigEntry(n), false
+			cfg.checks = append(cfg.checks, entry)
+			continue
+		case "[checks.headers]":
+			if len(cfg.checks) == 0 {
+				return nil, fmt.Errorf("line %d: [checks.headers] before [[checks]]", n)
+			}
+			entry, headers = cfg.checks[len(cfg.checks)-1], true
+			continue
+		}
+		if strings.HasPrefix(text, "[") {
+			return nil, fmt.Errorf("line %d: unknown table %s", n, text)
+		}
+		if entry == nil {
+			return nil, fmt.Errorf("line %d: expected a table", n)
+		}
+		key, value, found := strings.Cut(text, "=")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key, value = unquote(key), unquote(value)
+		if headers {
+			entry.headers[key] = value
+		} else {
+			entry.values[key] = value
+		}
+	}
+	return cfg, nil
+}
+
+// Environment variables that override the global defaults
+var configEnvironment = map[string]string{
+	"method":        "HTTP2CHECK_METHOD",
+	"timeout":       "HTTP2CHECK_TIMEOUT",
+	"expect_proto":  "HTTP2CHECK_EXPECT_PROTO",
+	"expect_status": "HTTP2CHECK_EXPECT_STATUS",
+	"min_tls":       "HTTP2CHECK_MIN_TLS",
+	"verify_cert":   "HTTP2CHECK_VERIFY_CERT",
+	"max_latency":   "HTTP2CHECK_MAX_LATENCY",
+}
+
+// Build a target from a configuration entry, using the defaults for the
+// values the entry does not set
+func (cfg *rawConfig) target(e *configEntry) (*target, error) {
+	get := func(key string) string {
+		if v, ok := e.values[key]; ok {
+			return v
+		}
+		return cfg.defaults.values[key]
+	}
+	for key := range e.values {
+		if _, ok := configEnvironment[key]; !ok && key != "url" {
+			return nil, fmt.Errorf("line %d: unknown key %q", e.line, key)
+		}
+	}
+
+	t := &target{URL: get("url"), Method: strings.ToUpper(get("method")), Headers: make(http.Header), Timeout: defaultTimeout}
+	if t.URL == "" {
+		return nil, fmt.Errorf("line %d: url is missing", e.line)
+	}
+	if t.Method == "" {
+		t.Method = "GET"
+	}
+	for k, v := range cfg.defaults.headers {
+		t.Headers.Set(k, v)
+	}
+	for k, v := range e.headers {
+		t.Headers.Set(k, v)
+	}
+	if s := get("timeout"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", e.line, err)
+		}
+		t.Timeout = d
+	}
+	t.Expect.Proto = get("expect_proto")
+	t.Expect.Status = get("expect_status")
+	if s := get("min_tls"); s != "" {
+		v, err := parseTLSVersion(s)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", e.line, err)
+		}
+		t.Expect.MinTLS = v
+	}
+	t.Expect.VerifyCert = env.AsBool(get("verify_cert"))
+	if s := get("max_latency"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", e.line, err)
+		}
+		t.Expect.MaxLatency = d
+	}
+	return t, nil
+}
+
+// Read a configuration file in either YAML or TOML format, depending on the
+// extension, and return the targets it describes
+func readConfig(filename string) ([]*target, error) {
+	data, err := os.ReadFile(env.ExpandUser(filename))
+	if err != nil {
+		return nil, err
+	}
+	var cfg *rawConfig
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		cfg, err = parseYAMLConfig(string(data))
+	case ".toml":
+		cfg, err = parseTOMLConfig(string(data))
+	default:
+		return nil, fmt.Errorf("%s: the configuration file must end with .yaml, .yml or .toml", filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	for key := range cfg.defaults.values {
+		if _, ok := configEnvironment[key]; !ok {
+			return nil, fmt.Errorf("%s: unknown default %q", filename, key)
+		}
+	}
+
+	// Environment variables override the global defaults
+	for key, name := range configEnvironment {
+		if env.Has(name) {
+			cfg.defaults.values[key] = env.Str(name)
+		}
+	}
+
+	var targets []*target
+	for _, e := range cfg.checks {
+		t, err := cfg.target(e)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// Check all the targets in the given configuration file. Returns the
+// records and the exit code of the first target that failed, if any.
+func runConfig(o *vt.TextOutput, filename string) ([]*record, int) {
+	targets, err := readConfig(filename)
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	var records []*record
+	failed, code := 0, exitOK
+	for i, t := range targets {
+		if i > 0 {
+			o.Println()
+		}
+		url := prepareURL(o, t.URL)
+		o.Println(vt.DarkGray.Get(t.Method) + " " + vt.LightCyan.Get(url))
+		ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
+		r := checkRequest(ctx, t.Method, url, t.Headers)
+		cancel()
+		printResult(o, r)
+		rec := &record{Method: t.Method, Result: r, Assertions: t.Expect.evaluate(r)}
+		records = append(records, rec)
+		if c := exitCode(r, printAssertions(o, rec.Assertions)); c != exitOK {
+			failed++
+			if code == exitOK {
+				code = c
+			}
+		}
+	}
+	o.Println()
+	if failed > 0 {
+		msg(o, "summary", vt.Red.Get(fmt.Sprintf("%d of %d checks failed", failed, len(targets))))
+	} else {
+		msg(o, "summary", vt.LightGreen.Get(fmt.Sprintf("all %d checks passed", len(targets))))
+	}
+	return records, code
+}
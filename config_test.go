@@ -0,0 +1,107 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Flatten a configuration entry into one map, with the headers as
+// "headers.NAME" keys, for comparing it with what is expected
+func flatten(e *configEntry) map[string]string {
+	m := make(map[string]string)
+	for k, v := range e.values {
+		m[k] = v
+	}
+	for k, v := range e.headers {
+		m["headers."+k] = v
+	}
+	return m
+}
+
+// configTest is a configuration file and what it should be parsed as
+type configTest struct {
+	name     string
+	data     string
+	err      string // a part of the expected error, if an error is expected
+	defaults map[string]string
+	checks   []map[string]string
+}
+
+func runConfigTests(t *testing.T, parse func(string) (*rawConfig, error), tests []configTest) {
+	t.Helper()
+	for _, tt := range tests {
+		cfg, err := parse(tt.data)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if got := flatten(cfg.defaults); !reflect.DeepEqual(got, tt.defaults) {
+			t.Errorf("%s: got defaults %v, want %v", tt.name, got, tt.defaults)
+		}
+		var checks []map[string]string
+		for _, e := range cfg.checks {
+			checks = append(checks, flatten(e))
+		}
+		if !reflect.DeepEqual(checks, tt.checks) {
+			t.Errorf("%s: got checks %v, want %v", tt.name, checks, tt.checks)
+		}
+	}
+}
+
+func TestParseYAMLConfig(t *testing.T) {
+	runConfigTests(t, parseYAMLConfig, []configTest{
+		{
+			name:     "indented list",
+			data:     "defaults:\n  timeout: 5s\n  headers:\n    user-agent: http2check\nchecks:\n  - url: https://example.com\n    expect_status: 2xx\n  - url: https://example.org # comment\n",
+			defaults: map[string]string{"timeout": "5s", "headers.user-agent": "http2check"},
+			checks: []map[string]string{
+				{"url": "https://example.com", "expect_status": "2xx"},
+				{"url": "https://example.org"},
+			},
+		},
+		{
+			name:     "list that is not indented",
+			data:     "checks:\n- url: https://example.com\n  headers:\n    accept: text/html\n- url: \"https://example.org\"\n  method: HEAD\n",
+			defaults: map[string]string{},
+			checks: []map[string]string{
+				{"url": "https://example.com", "headers.accept": "text/html"},
+				{"url": "https://example.org", "method": "HEAD"},
+			},
+		},
+		{
+			name:     "dash on its own line",
+			data:     "---\nchecks:\n  -\n    url: https://example.com\n",
+			defaults: map[string]string{},
+			checks:   []map[string]string{{"url": "https://example.com"}},
+		},
+		{name: "unknown section", data: "targets:\n  - url: https://example.com\n", err: `unknown section "targets"`},
+		{name: "list in defaults", data: "defaults:\n- url: https://example.com\n", err: "list items are only allowed in checks"},
+		{name: "tabs", data: "checks:\n\t- url: https://example.com\n", err: "tabs are not allowed"},
+		{name: "no list item", data: "checks:\n  url: https://example.com\n", err: "expected a list item"},
+	})
+}
+
+func TestParseTOMLConfig(t *testing.T) {
+	runConfigTests(t, parseTOMLConfig, []configTest{
+		{
+			name:     "defaults and checks",
+			data:     "[defaults]\ntimeout = \"5s\"\n\n[defaults.headers]\nuser-agent = \"http2check\"\n\n[[checks]]\nurl = \"https://example.com\"\nexpect_status = \"2xx\"\n\n[checks.headers]\naccept = \"text/html\"\n\n[[checks]]\nurl = \"https://example.org\" # comment\n",
+			defaults: map[string]string{"timeout": "5s", "headers.user-agent": "http2check"},
+			checks: []map[string]string{
+				{"url": "https://example.com", "expect_status": "2xx", "headers.accept": "text/html"},
+				{"url": "https://example.org"},
+			},
+		},
+		{name: "headers before checks", data: "[checks.headers]\naccept = \"text/html\"\n", err: "[checks.headers] before [[checks]]"},
+		{name: "unknown table", data: "[targets]\nurl = \"https://example.com\"\n", err: "unknown table [targets]"},
+		{name: "no table", data: "url = \"https://example.com\"\n", err: "expected a table"},
+		{name: "no value", data: "[[checks]]\nurl\n", err: "expected key = value"},
+	})
+}
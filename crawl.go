@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xyproto/vt"
+)
+
+// The largest page that will be read when crawling
+const crawlMaxBytes = 8 << 20
+
+var (
+	// Start tags that may refer to other origins
+	crawlTagPattern = regexp.MustCompile(`(?is)<(script|link|img|iframe)\b([^>]*)>`)
+
+	// Attributes within a tag, with or without quotes
+	crawlAttrPattern = regexp.MustCompile(`(?is)([a-z-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// crawlOrigin is an origin that a page refers to, and how
+type crawlOrigin struct {
+	origin string
+	refs   map[string]bool // for example "script" or "preconnect"
+}
+
+// Return how the page refers to the origin, as a sorted comma separated list
+func (co *crawlOrigin) referencedBy() string {
+	var refs []string
+	for ref := range co.refs {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return strings.Join(refs, ",")
+}
+
+// Find the origins that the script, link, img and iframe tags in the page
+// refer to, in the order they first appear
+func findOrigins(base *neturl.URL, page string) []*crawlOrigin {
+	var origins []*crawlOrigin
+	seen := make(map[string]*crawlOrigin)
+	for _, m := range crawlTagPattern.FindAllStringSubmatch(page, -1) {
+		tag := strings.ToLower(m[1])
+		attrs := make(map[string]string)
+		for _, a := range crawlAttrPattern.FindAllStringSubmatch(m[2], -1) {
+			attrs[strings.ToLower(a[1])] = a[2] + a[3] + a[4]
+		}
+		ref, value := tag, attrs["src"]
+		if tag == "link" {
+			value = attrs["href"]
+			if rel := strings.ToLower(attrs["rel"]); strings.Contains(rel, "preconnect") {
+				ref = "preconnect"
+			}
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		u, err := base.Parse(value)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			continue
+		}
+		origin := u.Scheme + "://" + strings.ToLower(u.Host)
+		co, ok := seen[origin]
+		if !ok {
+			co = &crawlOrigin{origin: origin, refs: make(map[string]bool)}
+			seen[origin] = co
+			origins = append(origins, co)
+		}
+		co.refs[ref] = true
+	}
+	return origins
+}
+
+// Fetch a page over HTTP/2 and return the final URL and the body
+func fetchPage(url string) (*neturl.URL, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	rt := newTransport()
+	defer rt.CloseIdleConnections()
+	res, err := (&http.Client{Transport: rt}).Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return nil, "", fmt.Errorf("got %s", res.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, crawlMaxBytes))
+	if err != nil {
+		return nil, "", err
+	}
+	return res.Request.URL, string(body), nil
+}
+
+// Check if the server at the given URL responds over HTTP/1.1, for telling
+// origins that are stuck on HTTP/1.1 apart from origins that are down
+func respondsOverHTTP1(url string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return false
+	}
+	rt := &http.Transport{TLSClientConfig: newTLSConfig("", "http/1.1")}
+	defer rt.CloseIdleConnections()
+	res, err := rt.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	res.Body.Close()
+	return true
+}
+
+// Fetch the page at the given URL, find all the origins it refers to and
+// check each of them for HTTP/2 support
+func runCrawl(o *vt.TextOutput, url string) {
+	o.Println(vt.DarkGray.Get("CRAWL") + " " + vt.LightCyan.Get(url))
+	base, page, err := fetchPage(url)
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	origins := findOrigins(base, page)
+	if len(origins) == 0 {
+		msg(o, "origins", vt.LightYellow.Get("none found"))
+		return
+	}
+
+	row := func(origin, proto, latency, refs string) string {
+		return fmt.Sprintf("%-40s %-10s %9s  %s", origin, proto, latency, refs)
+	}
+	o.Println()
+	o.Println(vt.DarkGray.Get(row("origin", "protocol", "latency", "referenced by")))
+	stuck := 0
+	for _, co := range origins {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+		r := check(ctx, co.origin)
+		cancel()
+		latency := r.Timings.Total.Round(time.Millisecond).String()
+		switch {
+		case r.ok() && r.Proto == "HTTP/2.0":
+			o.Println(row(co.origin, vt.LightGreen.Get(fmt.Sprintf("%-10s", "HTTP/2")), latency, vt.DarkGray.Get(co.referencedBy())))
+		case (r.Class == classNoH2 || r.Class == classTLS) && respondsOverHTTP1(co.origin):
+			stuck++
+			o.Println(row(co.origin, vt.Red.Get(fmt.Sprintf("%-10s", "HTTP/1.1")), latency, vt.DarkGray.Get(co.referencedBy())))
+		default:
+			o.Println(row(co.origin, vt.LightYellow.Get(fmt.Sprintf("%-10s", r.Class)), latency, vt.DarkGray.Get(co.referencedBy())+" "+r.summary()))
+		}
+	}
+	o.Println()
+	if stuck > 0 {
+		msg(o, "origins", vt.Red.Get(fmt.Sprintf("%d of %d stuck on HTTP/1.1", stuck, len(origins))))
+	} else {
+		msg(o, "origins", vt.LightGreen.Get(fmt.Sprintf("%d checked, none stuck on HTTP/1.1", len(origins))))
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xyproto/vt"
+)
+
+// resultsFile is the JSON file that --json writes and the diff subcommand reads
+type resultsFile struct {
+	Version   string    `json:"version"`
+	Generated time.Time `json:"generated"`
+	Records   []*record `json:"records"`
+}
+
+// Write the records to a JSON file
+func writeJSON(filename string, records []*record) error {
+	data, err := json.MarshalIndent(resultsFile{Version: versionString, Generated: time.Now(), Records: records}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+// Read the records from a JSON file
+func readJSON(filename string) (*resultsFile, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var rf resultsFile
+	if err := json.Unmarshal(data, &rf); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return &rf, nil
+}
+
+// slowerThreshold is how much slower a check must be to count as a
+// regression, either as a duration or as a percentage
+type slowerThreshold struct {
+	d       time.Duration
+	percent float64
+}
+
+// Parse a threshold like "200ms" or "50%"
+func parseSlowerThreshold(s string) (slowerThreshold, error) {
+	if strings.HasSuffix(s, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		return slowerThreshold{percent: p}, err
+	}
+	d, err := time.ParseDuration(s)
+	return slowerThreshold{d: d}, err
+}
+
+// Check if going from the old to the new duration is slower than the threshold allows
+func (t slowerThreshold) exceeded(before, after time.Duration) bool {
+	if t.percent > 0 {
+		return float64(after) > float64(before)*(1+t.percent/100)
+	}
+	return after-before > t.d
+}
+
+// change is one difference between two results for the same target
+type change struct {
+	regression bool // true if this is a change for the worse
+	what       string
+}
+
+// Compare two results for the same target
+func compareResults(before, after *checkResult, slower slowerThreshold) []change {
+	var changes []change
+	add := func(regression bool, format string, args ...interface{}) {
+		changes = append(changes, change{regression, fmt.Sprintf(format, args...)})
+	}
+	h2Before := before.ok() && before.Proto == "HTTP/2.0"
+	h2After := after.ok() && after.Proto == "HTTP/2.0"
+	switch {
+	case h2Before && !h2After:
+		add(true, "lost HTTP/2 (%s)", after.summary())
+	case !h2Before && h2After:
+		add(false, "gained HTTP/2")
+	case before.ok() && !after.ok():
+		add(true, "now fails (%s)", after.summary())
+	}
+	// The TLS version and the status are only known if both checks got a response
+	if before.ok() && after.ok() {
+		if before.TLSVersionID != after.TLSVersionID {
+			add(after.TLSVersionID < before.TLSVersionID, "TLS version changed from %q to %q", before.TLSVersion, after.TLSVersion)
+		}
+		if before.StatusCode != after.StatusCode {
+			add(after.StatusCode >= 400 && before.StatusCode < 400, "status changed from %q to %q", before.Status, after.Status)
+		}
+	}
+	if before.CertSHA256 != after.CertSHA256 && before.CertSHA256 != "" && after.CertSHA256 != "" {
+		add(false, "certificate changed, now expires %s", after.CertExpiry.Format("2006-01-02"))
+	}
+	if before.ok() && after.ok() && slower.exceeded(before.Timings.Total, after.Timings.Total) {
+		add(true, "slower, from %s to %s", before.Timings.Total.Round(time.Millisecond), after.Timings.Total.Round(time.Millisecond))
+	}
+	return changes
+}
+
+// Run the "diff" subcommand, which compares two JSON result files and
+// reports the differences. Exits with a non-zero exit code if any of the
+// differences are regressions.
+func runDiff(o *vt.TextOutput, args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+
+	slowerHelp := "How much slower a check may get, as a duration or a percentage"
+	regressionsHelp := "Only show regressions"
+
+	slowerFlag := fs.String("slower", "200ms", slowerHelp)
+	regressionsOnly := fs.Bool("regressions", false, regressionsHelp)
+
+	fs.Usage = func() {
+		fmt.Println()
+		fmt.Println("Syntax: http2check diff [flags] OLD.json NEW.json")
+		fmt.Println()
+		fmt.Println("Possible flags:")
+		fmt.Println("    -slower THRESHOLD          " + slowerHelp)
+		fmt.Println("    -regressions               " + regressionsHelp)
+		fmt.Println()
+	}
+
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	slower, err := parseSlowerThreshold(*slowerFlag)
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	before, err := readJSON(fs.Arg(0))
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	after, err := readJSON(fs.Arg(1))
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+
+	key := func(rec *record) string {
+		return rec.name()
+	}
+	old := make(map[string]*record)
+	for _, rec := range before.Records {
+		old[key(rec)] = rec
+	}
+
+	regressions := 0
+	report := func(target string, c change) {
+		if c.regression {
+			regressions++
+			msg(o, target, vt.Red.Get(c.what))
+		} else if !*regressionsOnly {
+			msg(o, target, vt.LightGreen.Get(c.what))
+		}
+	}
+	for _, rec := range after.Records {
+		k := key(rec)
+		prev, ok := old[k]
+		if !ok {
+			report(k, change{what: "new target"})
+			continue
+		}
+		delete(old, k)
+		for _, c := range compareResults(prev.Result, rec.Result, slower) {
+			report(k, c)
+		}
+	}
+	for _, rec := range before.Records {
+		if _, ok := old[key(rec)]; ok {
+			report(key(rec), change{regression: true, what: "target removed"})
+		}
+	}
+
+	if regressions > 0 {
+		o.Println()
+		msg(o, "diff", vt.Red.Get(fmt.Sprintf("%d regressions", regressions)))
+		os.Exit(1)
+	}
+	msg(o, "diff", vt.LightGreen.Get("no regressions"))
+}
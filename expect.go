@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xyproto/vt"
+)
+
+// expectations are what a check result must live up to
+type expectations struct {
+	Proto      string // the expected protocol, for example "HTTP/2.0"
+	Status     string // the expected status codes, for example "200", "2xx" or "200,301"
+	MinTLS     uint16 // the lowest accepted TLS version, 0 for any
+	VerifyCert bool   // if the certificate must be valid for the host
+
+	MaxLatency time.Duration // the longest the check may take, 0 for any
+}
+
+// assertion is the outcome of comparing one expectation with a check result
+type assertion struct {
+	Name     string `json:"name"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	OK       bool   `json:"ok"`
+}
+
+// Parse a TLS version like "1.2" or "TLS 1.2"
+func parseTLSVersion(s string) (uint16, error) {
+	switch strings.TrimSpace(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "TLS")) {
+	case "1", "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version: %q", s)
+}
+
+// Check if the status code matches a pattern like "200", "2xx" or "200,301"
+func statusMatches(pattern string, code int) bool {
+	s := strconv.Itoa(code)
+	for _, p := range strings.Split(pattern, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if len(p) != len(s) {
+			continue
+		}
+		match := true
+		for i := range p {
+			if p[i] != 'x' && p[i] != s[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare the check result with the expectations. Only the expectations
+// that are set are included.
+func (e *expectations) evaluate(r *checkResult) []assertion {
+	var as []assertion
+	if e.Proto != "" {
+		as = append(as, assertion{Name: "proto", Expected: e.Proto, Actual: r.Proto, OK: r.ok() && r.Proto == e.Proto})
+	}
+	if e.Status != "" {
+		as = append(as, assertion{Name: "status", Expected: e.Status, Actual: r.Status, OK: r.ok() && statusMatches(e.Status, r.StatusCode)})
+	}
+	if e.MinTLS != 0 {
+		as = append(as, assertion{Name: "min-tls", Expected: tls.VersionName(e.MinTLS), Actual: r.TLSVersion, OK: r.ok() && r.TLSVersionID >= e.MinTLS})
+	}
+	if e.MaxLatency > 0 {
+		as = append(as, assertion{Name: "latency", Expected: "<= " + e.MaxLatency.String(), Actual: r.Timings.Total.Round(time.Millisecond).String(), OK: r.ok() && r.Timings.Total <= e.MaxLatency})
+	}
+	if e.VerifyCert {
+		actual := "valid"
+		if r.CertError != "" {
+			actual = r.CertError
+		}
+		as = append(as, assertion{Name: "cert", Expected: "valid", Actual: actual, OK: r.ok() && r.CertError == ""})
+	}
+	return as
+}
+
+// Print the assertions and return true if all of them passed
+func printAssertions(o *vt.TextOutput, as []assertion) bool {
+	passed := true
+	for _, a := range as {
+		if a.OK {
+			msg(o, "expect "+a.Name, vt.LightGreen.Get(a.Expected))
+			continue
+		}
+		passed = false
+		actual := a.Actual
+		if actual == "" {
+			actual = "nothing"
+		}
+		msg(o, "expect "+a.Name, vt.Red.Get(a.Expected), "got "+actual)
+	}
+	return passed
+}
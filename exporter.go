@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/xyproto/vt"
+)
+
+// The longest a single probe may take, unless Prometheus asks for less
+const probeTimeout = 10 * time.Second
+
+// exporter serves check results as Prometheus metrics
+type exporter struct {
+	probes   int64 // the number of probes that have been done
+	failures int64 // the number of probes that did not pass
+}
+
+// Write one gauge with an optional help text and labels, in the Prometheus text format
+func writeGauge(w io.Writer, name, help string, value float64, labels ...string) {
+	if help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+	fmt.Fprint(w, name)
+	if len(labels) > 0 {
+		var pairs []string
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, labels[i]+"="+strconv.Quote(labels[i+1]))
+		}
+		fmt.Fprint(w, "{"+strings.Join(pairs, ",")+"}")
+	}
+	fmt.Fprintf(w, " %s\n", strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// Return 1 for true and 0 for false
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Serve metrics about the exporter itself
+func (e *exporter) metrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeGauge(w, "http2check_build_info", "The version of http2check", 1, "version", strings.TrimPrefix(versionString, "http2check "))
+	fmt.Fprintf(w, "# HELP http2check_probes_total The number of probes that have been done\n# TYPE http2check_probes_total counter\nhttp2check_probes_total %d\n", atomic.LoadInt64(&e.probes))
+	fmt.Fprintf(w, "# HELP http2check_probe_failures_total The number of probes that did not pass\n# TYPE http2check_probe_failures_total counter\nhttp2check_probe_failures_total %d\n", atomic.LoadInt64(&e.failures))
+}
+
+// Check the target given in the query string and serve the result as metrics
+func (e *exporter) probe(w http.ResponseWriter, req *http.Request) {
+	target := req.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	url, _, err := normalizeURL(target)
+	if err != nil {
+		http.Error(w, "invalid target: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Respect the scrape timeout that Prometheus sends, if it is shorter
+	timeout := probeTimeout
+	if s, err := strconv.ParseFloat(req.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64); err == nil && s > 0 {
+		if d := time.Duration(s * float64(time.Second)); d < timeout {
+			timeout = d
+		}
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	r := check(ctx, url)
+	atomic.AddInt64(&e.probes, 1)
+	if !r.passing() {
+		atomic.AddInt64(&e.failures, 1)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeGauge(w, "probe_success", "Whether the server responded over HTTP/2 with a non-error status", boolGauge(r.passing()))
+	writeGauge(w, "probe_http2", "Whether HTTP/2 was negotiated", boolGauge(r.ok() && r.Proto == "HTTP/2.0"))
+	writeGauge(w, "probe_duration_seconds", "How long the probe took", r.Timings.Total.Seconds())
+	if r.ok() {
+		writeGauge(w, "probe_http_protocol_info", "The negotiated protocol", 1, "proto", r.Proto)
+		writeGauge(w, "probe_http_status_code", "The response status code", float64(r.StatusCode))
+	} else {
+		writeGauge(w, "probe_failed_due_to", "Why the probe failed", 1, "class", r.Class)
+	}
+	if r.TLSVersion != "" {
+		writeGauge(w, "probe_tls_version_info", "The negotiated TLS version", 1, "version", r.TLSVersion)
+	}
+	if !r.CertExpiry.IsZero() {
+		writeGauge(w, "probe_ssl_earliest_cert_expiry", "When the server certificate expires, in Unix time", float64(r.CertExpiry.Unix()))
+	}
+	phases := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"resolve", r.Timings.DNS},
+		{"connect", r.Timings.Connect},
+		{"tls", r.Timings.TLS},
+		{"processing", r.Timings.Processing},
+	}
+	fmt.Fprint(w, "# HELP probe_http_duration_seconds The duration of each phase of the request\n# TYPE probe_http_duration_seconds gauge\n")
+	for _, p := range phases {
+		writeGauge(w, "probe_http_duration_seconds", "", p.d.Seconds(), "phase", p.name)
+	}
+}
+
+// Run the "exporter" subcommand, which serves /metrics and /probe?target=...
+// for Prometheus, in the same way as the blackbox exporter
+func runExporter(o *vt.TextOutput, args []string) {
+	fs := flag.NewFlagSet("exporter", flag.ExitOnError)
+
+	listenHelp := "Address to listen on"
+
+	listen := fs.String("listen", ":9116", listenHelp)
+
+	fs.Usage = func() {
+		fmt.Println()
+		fmt.Println("Syntax: http2check exporter [flags]")
+		fmt.Println()
+		fmt.Println("Possible flags:")
+		fmt.Println("    -listen ADDR               " + listenHelp)
+		fmt.Println()
+	}
+
+	fs.Parse(args)
+
+	e := &exporter{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", e.metrics)
+	mux.HandleFunc("/probe", e.probe)
+
+	o.Println(vt.DarkGray.Get("EXPORTER") + " " + vt.LightCyan.Get(*listen))
+	if err := http.ListenAndServe(*listen, mux); err != nil {
+		o.ErrExit(err.Error())
+	}
+}
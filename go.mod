@@ -3,6 +3,7 @@ module github.com/xyproto/http2check
 go 1.24.4
 
 require (
+	github.com/xyproto/env/v2 v2.5.3
 	github.com/xyproto/vt v1.2.10
 	golang.org/x/net v0.47.0
 )
@@ -10,7 +11,6 @@ require (
 require (
 	github.com/pkg/term v1.2.0-beta.2.0.20210419004637-f749b98bd0ba // indirect
 	github.com/xyproto/burnfont v1.2.3 // indirect
-	github.com/xyproto/env/v2 v2.5.3 // indirect
 	golang.org/x/sys v0.38.0 // indirect
 	golang.org/x/term v0.37.0 // indirect
 	golang.org/x/text v0.31.0 // indirect
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strconv"
+
+	"github.com/xyproto/vt"
+)
+
+// The path of the standard gRPC health checking service
+const grpcHealthPath = "/grpc.health.v1.Health/Check"
+
+// The values of grpc.health.v1.HealthCheckResponse.ServingStatus
+var grpcServingStatus = map[uint64]string{
+	0: "UNKNOWN",
+	1: "SERVING",
+	2: "NOT_SERVING",
+	3: "SERVICE_UNKNOWN",
+}
+
+// grpcHealthFlag is a flag that can be given both as --grpc-health and as
+// --grpc-health=SERVICE
+type grpcHealthFlag struct {
+	enabled bool
+	service string
+}
+
+func (g *grpcHealthFlag) String() string {
+	return g.service
+}
+
+func (g *grpcHealthFlag) Set(s string) error {
+	switch s {
+	case "true":
+		g.enabled, g.service = true, ""
+	case "false":
+		g.enabled, g.service = false, ""
+	default:
+		g.enabled, g.service = true, s
+	}
+	return nil
+}
+
+// IsBoolFlag makes it possible to give the flag without a value
+func (g *grpcHealthFlag) IsBoolFlag() bool {
+	return true
+}
+
+// Encode a grpc.health.v1.HealthCheckRequest as a length prefixed gRPC message
+func grpcHealthRequest(service string) []byte {
+	var msg []byte
+	if service != "" {
+		// Field 1, wire type 2 (length delimited)
+		msg = append(msg, 0x0a)
+		msg = binary.AppendUvarint(msg, uint64(len(service)))
+		msg = append(msg, service...)
+	}
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// Decode the serving status from a length prefixed grpc.health.v1.HealthCheckResponse
+func grpcHealthResponse(body []byte) (string, error) {
+	if len(body) < 5 {
+		return "", errors.New("no gRPC message in the response")
+	}
+	if body[0] != 0 {
+		return "", errors.New("compressed gRPC messages are not supported")
+	}
+	n := binary.BigEndian.Uint32(body[1:5])
+	if uint32(len(body)-5) < n {
+		return "", errors.New("truncated gRPC message")
+	}
+	msg := body[5 : 5+n]
+	status := uint64(0)
+	for len(msg) > 0 {
+		key, i := binary.Uvarint(msg)
+		if i <= 0 {
+			return "", errors.New("invalid protobuf field")
+		}
+		msg = msg[i:]
+		switch key & 7 {
+		case 0: // varint
+			v, i := binary.Uvarint(msg)
+			if i <= 0 {
+				return "", errors.New("invalid protobuf varint")
+			}
+			msg = msg[i:]
+			if key>>3 == 1 {
+				status = v
+			}
+		case 2: // length delimited
+			l, i := binary.Uvarint(msg)
+			if i <= 0 || uint64(len(msg)-i) < l {
+				return "", errors.New("invalid protobuf length")
+			}
+			msg = msg[i+int(l):]
+		default:
+			return "", fmt.Errorf("unexpected protobuf wire type %d", key&7)
+		}
+	}
+	if name, ok := grpcServingStatus[status]; ok {
+		return name, nil
+	}
+	return strconv.FormatUint(status, 10), nil
+}
+
+// Send a grpc.health.v1.Health/Check request for the given service, and
+// print the protocol, the gRPC status and the serving status
+func runGRPCHealth(o *vt.TextOutput, url, service string) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	u.Path, u.RawQuery = grpcHealthPath, ""
+	url = u.String()
+
+	o.Println(vt.DarkGray.Get("POST") + " " + vt.LightCyan.Get(url))
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(grpcHealthRequest(service)))
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	req.Header.Set("content-type", "application/grpc")
+	req.Header.Set("te", "trailers")
+
+	rt := newTransport()
+	if u.Scheme == "http" {
+		rt = newH2CTransport()
+	}
+	// Exit with the same exit code as a regular check would, for timeouts
+	// and connection failures
+	fail := func(err error) {
+		class, _, _, _ := classifyError(err)
+		o.Err(err.Error())
+		os.Exit(classExitCodes[class])
+	}
+	res, err := rt.RoundTrip(req)
+	if err != nil {
+		fail(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		fail(err)
+	}
+
+	msg(o, "protocol", vt.White.Get(res.Proto))
+	msg(o, "status", vt.White.Get(res.Status))
+
+	// A response without a message may have the gRPC status in the headers
+	grpcStatus, grpcMessage := res.Trailer.Get("grpc-status"), res.Trailer.Get("grpc-message")
+	if grpcStatus == "" {
+		grpcStatus, grpcMessage = res.Header.Get("grpc-status"), res.Header.Get("grpc-message")
+	}
+	if grpcStatus == "" {
+		msg(o, "grpc-status", vt.Red.Get("Missing"), "not a gRPC server")
+		os.Exit(1)
+	}
+	if grpcStatus != "0" {
+		msg(o, "grpc-status", vt.Red.Get(grpcStatus), grpcMessage)
+		os.Exit(1)
+	}
+	msg(o, "grpc-status", vt.White.Get(grpcStatus))
+
+	serving, err := grpcHealthResponse(body)
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	name := "health"
+	if service != "" {
+		name = "health " + service
+	}
+	if serving == "SERVING" {
+		msg(o, name, vt.LightGreen.Get(serving))
+	} else {
+		msg(o, name, vt.Red.Get(serving))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The HAR 1.2 elements, as understood by browser devtools and HAR viewers
+type (
+	harFile struct {
+		Log harLog `json:"log"`
+	}
+	harLog struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	}
+	harCreator struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	harEntry struct {
+		StartedDateTime string      `json:"startedDateTime"`
+		Time            float64     `json:"time"`
+		Request         harRequest  `json:"request"`
+		Response        harResponse `json:"response"`
+		Cache           struct{}    `json:"cache"`
+		Timings         harTimings  `json:"timings"`
+		ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+		Connection      string      `json:"connection,omitempty"`
+		Error           string      `json:"_error,omitempty"` // why there is no response, if there is none
+	}
+	harRequest struct {
+		Method      string         `json:"method"`
+		URL         string         `json:"url"`
+		HTTPVersion string         `json:"httpVersion"`
+		Cookies     []harNameValue `json:"cookies"`
+		Headers     []harNameValue `json:"headers"`
+		QueryString []harNameValue `json:"queryString"`
+		HeadersSize int            `json:"headersSize"`
+		BodySize    int            `json:"bodySize"`
+	}
+	harResponse struct {
+		Status      int            `json:"status"`
+		StatusText  string         `json:"statusText"`
+		HTTPVersion string         `json:"httpVersion"`
+		Cookies     []harNameValue `json:"cookies"`
+		Headers     []harNameValue `json:"headers"`
+		Content     harContent     `json:"content"`
+		RedirectURL string         `json:"redirectURL"`
+		HeadersSize int            `json:"headersSize"`
+		BodySize    int64          `json:"bodySize"`
+	}
+	harContent struct {
+		Size     int64  `json:"size"`
+		MimeType string `json:"mimeType"`
+	}
+	harNameValue struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	harTimings struct {
+		Blocked float64 `json:"blocked"`
+		DNS     float64 `json:"dns"`
+		Connect float64 `json:"connect"`
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+		SSL     float64 `json:"ssl"`
+	}
+)
+
+// Format a duration as milliseconds, which is what HAR uses. Phases that
+// did not happen, like DNS for an IP address, are -1.
+func harMillis(d time.Duration) float64 {
+	if d == 0 {
+		return -1
+	}
+	return float64(d.Microseconds()) / 1000
+}
+
+// Convert the header to name and value pairs, sorted by name
+func harHeaders(header http.Header) []harNameValue {
+	fields := []harNameValue{}
+	for name, values := range header {
+		for _, v := range values {
+			fields = append(fields, harNameValue{strings.ToLower(name), v})
+		}
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return fields
+}
+
+// Convert a record to a HAR entry
+func newHAREntry(rec *record) harEntry {
+	r := rec.Result
+	e := harEntry{
+		StartedDateTime: r.Started.Format(time.RFC3339Nano),
+		ServerIPAddress: r.ServerIP,
+		Connection:      r.Connection,
+		Request: harRequest{
+			Method:      rec.Method,
+			URL:         r.URL,
+			HTTPVersion: r.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+		},
+		Response: harResponse{
+			Status:      r.StatusCode,
+			HTTPVersion: r.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(r.responseHeaders),
+			Content:     harContent{Size: max(r.contentLength, 0), MimeType: r.responseHeaders.Get("Content-Type")},
+			RedirectURL: r.responseHeaders.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    r.contentLength,
+		},
+		Timings: harTimings{
+			Blocked: -1,
+			DNS:     harMillis(r.Timings.DNS),
+			// The connect time includes the TLS handshake
+			Connect: harMillis(r.Timings.Connect + r.Timings.TLS),
+			SSL:     harMillis(r.Timings.TLS),
+			// Send, wait and receive can not be -1
+			Wait: max(harMillis(r.Timings.Processing), 0),
+		},
+	}
+	for _, hf := range r.requestHeaders {
+		e.Request.Headers = append(e.Request.Headers, harNameValue{hf.Name, hf.Value})
+	}
+	if u, err := neturl.Parse(r.URL); err == nil {
+		for name, values := range u.Query() {
+			for _, v := range values {
+				e.Request.QueryString = append(e.Request.QueryString, harNameValue{name, v})
+			}
+		}
+	}
+	if _, text, found := strings.Cut(r.Status, " "); found {
+		e.Response.StatusText = text
+	}
+	if !r.ok() {
+		e.Response.BodySize = -1
+		e.Error = r.summary()
+	}
+	// The total time is the sum of the phases that happened
+	for _, t := range []float64{e.Timings.DNS, e.Timings.Connect, e.Timings.Send, e.Timings.Wait, e.Timings.Receive} {
+		e.Time += max(t, 0)
+	}
+	e.Time = math.Round(e.Time*1000) / 1000
+	return e
+}
+
+// Write the records as a HAR 1.2 file, with one entry per request
+func writeHAR(filename string, records []*record) error {
+	har := harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "http2check", Version: strings.TrimPrefix(versionString, "http2check ")},
+		Entries: []harEntry{},
+	}}
+	for _, rec := range records {
+		har.Log.Entries = append(har.Log.Entries, newHAREntry(rec))
+	}
+	data, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
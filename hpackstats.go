@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	neturl "net/url"
+
+	"github.com/xyproto/vt"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// The number of requests that are sent over one connection for --hpack-stats
+const hpackRequests = 10
+
+// The number of entries in the HPACK static table
+const hpackStaticEntries = 61
+
+// hpackStats counts how the fields in one or more header blocks were encoded
+type hpackStats struct {
+	fields       int   // number of header fields
+	raw          int   // header name and value bytes, before compression
+	encoded      int   // header block bytes, after compression
+	staticHits   int   // fields fully taken from the static table
+	dynamicHits  int   // fields fully taken from the dynamic table
+	dynamicNames int   // literal fields with a name from the dynamic table
+	indexed      int   // literal fields that were added to the dynamic table
+	strings      int   // number of string literals
+	huffman      int   // number of Huffman encoded string literals
+	sizeUpdates  []int // dynamic table size updates
+}
+
+// Read an HPACK integer with an n-bit prefix from the start of b, and return
+// the value together with the number of bytes that were used
+func hpackInt(b []byte, n uint) (int, int, error) {
+	if len(b) == 0 {
+		return 0, 0, errors.New("hpack: truncated integer")
+	}
+	mask := byte(1<<n - 1)
+	v := int(b[0] & mask)
+	if v < int(mask) {
+		return v, 1, nil
+	}
+	var shift uint
+	for i := 1; i < len(b); i++ {
+		v += int(b[i]&0x7f) << shift
+		if b[i]&0x80 == 0 {
+			return v, i + 1, nil
+		}
+		shift += 7
+		if shift > 28 {
+			return 0, 0, errors.New("hpack: integer overflow")
+		}
+	}
+	return 0, 0, errors.New("hpack: truncated integer")
+}
+
+// Skip over a string literal at the start of b, count it and return the
+// number of bytes it used
+func (s *hpackStats) hpackString(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, errors.New("hpack: truncated string")
+	}
+	huffman := b[0]&0x80 != 0
+	length, n, err := hpackInt(b, 7)
+	if err != nil {
+		return 0, err
+	}
+	if n+length > len(b) {
+		return 0, errors.New("hpack: truncated string")
+	}
+	s.strings++
+	if huffman {
+		s.huffman++
+	}
+	return n + length, nil
+}
+
+// Walk through the representations in the given header block and count how
+// each field was encoded. See RFC 7541, section 6.
+func (s *hpackStats) add(block []byte) error {
+	s.encoded += len(block)
+	for len(block) > 0 {
+		var prefix uint
+		switch b := block[0]; {
+		case b&0x80 != 0: // indexed header field
+			index, n, err := hpackInt(block, 7)
+			if err != nil {
+				return err
+			}
+			if index > hpackStaticEntries {
+				s.dynamicHits++
+			} else {
+				s.staticHits++
+			}
+			s.fields++
+			block = block[n:]
+			continue
+		case b&0xc0 == 0x40: // literal with incremental indexing
+			prefix = 6
+			s.indexed++
+		case b&0xe0 == 0x20: // dynamic table size update
+			size, n, err := hpackInt(block, 5)
+			if err != nil {
+				return err
+			}
+			s.sizeUpdates = append(s.sizeUpdates, size)
+			block = block[n:]
+			continue
+		default: // literal without indexing, or never indexed
+			prefix = 4
+		}
+		index, n, err := hpackInt(block, prefix)
+		if err != nil {
+			return err
+		}
+		block = block[n:]
+		if index == 0 {
+			// The name is a string literal
+			n, err = s.hpackString(block)
+			if err != nil {
+				return err
+			}
+			block = block[n:]
+		} else if index > hpackStaticEntries {
+			s.dynamicNames++
+		}
+		n, err = s.hpackString(block)
+		if err != nil {
+			return err
+		}
+		block = block[n:]
+		s.fields++
+	}
+	return nil
+}
+
+// Add the sizes of the given decoded header fields
+func (s *hpackStats) addRaw(fields []hpack.HeaderField) {
+	for _, hf := range fields {
+		s.raw += len(hf.Name) + len(hf.Value)
+	}
+}
+
+// Return a percentage, or 0 if the total is 0
+func percent(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(part) / float64(total)
+}
+
+// Send several requests with the same headers over one connection, and
+// return the statistics for the request and response header blocks
+func probeHPACK(url string) (req, res *hpackStats, perRequest []*hpackStats, err error) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rc, err := dialRaw(url)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rc.Close()
+
+	req, res = &hpackStats{}, &hpackStats{}
+	reqDec := hpack.NewDecoder(4096, nil)
+	headers := []string{
+		"user-agent", versionString,
+		"accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		"accept-language", "en-US,en;q=0.5",
+		"accept-encoding", "gzip, deflate, br",
+		"cache-control", "no-cache",
+	}
+	for i := 0; i < hpackRequests; i++ {
+		block := rc.encodeHeaders("GET", u.RequestURI(), headers...)
+		if err := req.add(block); err != nil {
+			return req, res, perRequest, err
+		}
+		fields, err := reqDec.DecodeFull(block)
+		if err != nil {
+			return req, res, perRequest, err
+		}
+		req.addRaw(fields)
+		id := rc.nextStreamID()
+		if err := rc.fr.WriteHeaders(http2.HeadersFrameParam{StreamID: id, BlockFragment: block, EndStream: true, EndHeaders: true}); err != nil {
+			return req, res, perRequest, err
+		}
+		this := &hpackStats{}
+		if _, err := readResponseHeaders(rc, id, res, this); err != nil {
+			return req, res, perRequest, err
+		}
+		perRequest = append(perRequest, this)
+	}
+	return req, res, perRequest, nil
+}
+
+// Print the header compression statistics for one direction
+func printHPACKStats(o *vt.TextOutput, name string, s *hpackStats) {
+	msg(o, name, vt.White.Get(fmt.Sprintf("%d bytes raw, %d bytes encoded", s.raw, s.encoded)), fmt.Sprintf("%.1f%% of raw", percent(s.encoded, s.raw)))
+	msg(o, name, vt.White.Get(fmt.Sprintf("%d fields, %d static hits, %d dynamic hits, %d dynamic names, %d added to table", s.fields, s.staticHits, s.dynamicHits, s.dynamicNames, s.indexed)))
+	msg(o, name, vt.White.Get(fmt.Sprintf("%d of %d strings Huffman encoded", s.huffman, s.strings)))
+}
+
+// Send a series of requests over one connection and report how well the
+// server compresses its response headers
+func runHPACKStats(o *vt.TextOutput, url string) {
+	o.Println(vt.DarkGray.Get("HPACK") + " " + vt.LightCyan.Get(url) + " " + vt.DarkGray.Get(fmt.Sprintf("(%d requests)", hpackRequests)))
+	req, res, perRequest, err := probeHPACK(url)
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	for i, s := range perRequest {
+		msg(o, fmt.Sprintf("#%d", i+1), vt.White.Get(fmt.Sprintf("%d/%d bytes", s.encoded, s.raw)), fmt.Sprintf("%d dynamic hits", s.dynamicHits))
+	}
+	printHPACKStats(o, "request", req)
+	printHPACKStats(o, "response", res)
+	if len(res.sizeUpdates) == 0 {
+		msg(o, "table", vt.White.Get("no dynamic table size changes"))
+	} else {
+		msg(o, "table", vt.LightYellow.Get(fmt.Sprintf("size changed to %v", res.sizeUpdates)))
+	}
+	switch {
+	case res.dynamicHits+res.dynamicNames > 0:
+		msg(o, "dynamic table", vt.LightGreen.Get("Used"))
+	case res.indexed > 0:
+		msg(o, "dynamic table", vt.LightYellow.Get("Filled, but never referenced"))
+	default:
+		msg(o, "dynamic table", vt.Red.Get("Not used"))
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	neturl "net/url"
+	"syscall"
+	"time"
+
+	"github.com/xyproto/vt"
+	"golang.org/x/net/http2"
+)
+
+// idleEvent is something that happened on an idle connection. The frame
+// details are copied, since the framer reuses its buffers.
+type idleEvent struct {
+	frameType    http2.FrameType
+	ack          bool
+	pingData     [8]byte
+	lastStreamID uint32
+	errCode      http2.ErrCode
+	debugData    string
+	err          error
+}
+
+// Describe how a connection ended, given the error from reading it
+func describeClose(err error) string {
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "closed by the server (FIN)"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "reset by the server (RST)"
+	}
+	return err.Error()
+}
+
+// Read frames from the connection and send a copy of the interesting parts
+// to the events channel, until reading fails
+func readIdleEvents(rc *rawConn, events chan<- idleEvent) {
+	for {
+		f, err := rc.fr.ReadFrame()
+		if err != nil {
+			events <- idleEvent{err: err}
+			return
+		}
+		ev := idleEvent{frameType: f.Header().Type}
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			ev.ack = f.IsAck()
+		case *http2.PingFrame:
+			ev.ack = f.IsAck()
+			ev.pingData = f.Data
+		case *http2.GoAwayFrame:
+			ev.lastStreamID = f.LastStreamID
+			ev.errCode = f.ErrCode
+			ev.debugData = string(f.DebugData())
+		case *http2.HeadersFrame:
+			// Keep the HPACK decoder in sync
+			if block, err := rc.readHeaderBlock(f.HeaderBlockFragment(), f.HeadersEnded()); err == nil {
+				rc.dec.DecodeFull(block)
+			}
+		}
+		events <- ev
+	}
+}
+
+// Send one request, then keep the connection idle for up to maxIdle and
+// report when and how the server ends it. If keepalive is not 0, a PING is
+// sent at that interval.
+func runIdle(o *vt.TextOutput, url string, maxIdle, keepalive time.Duration) {
+	o.Println(vt.DarkGray.Get("IDLE") + " " + vt.LightCyan.Get(url) + " " + vt.DarkGray.Get(fmt.Sprintf("(up to %s)", maxIdle)))
+	u, err := neturl.Parse(url)
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	rc, err := dialRaw(url)
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	defer rc.Close()
+
+	id, err := rc.request("GET", u.RequestURI(), true)
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	if _, err := readResponseHeaders(rc, id); err != nil {
+		o.ErrExit(err.Error())
+	}
+	msg(o, "request", vt.White.Get("done"), "connection is now idle")
+
+	// From now on, only the server decides when the connection ends
+	rc.conn.SetDeadline(time.Time{})
+	events := make(chan idleEvent)
+	go readIdleEvents(rc, events)
+
+	var tick <-chan time.Time
+	if keepalive > 0 {
+		ticker := time.NewTicker(keepalive)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	deadline := time.After(maxIdle)
+
+	var (
+		start     = time.Now()
+		pingsSent int
+		pingsAckd int
+		goaway    bool
+	)
+	for {
+		select {
+		case <-deadline:
+			msg(o, "idle", vt.LightGreen.Get("Still open"), fmt.Sprintf("after %s, %d of %d pings answered", maxIdle, pingsAckd, pingsSent))
+			return
+		case <-tick:
+			if err := rc.fr.WritePing(false, [8]byte{'h', '2', 'c', 'h', 'e', 'c', 'k'}); err != nil {
+				msg(o, "ping", vt.Red.Get("Failed"), err.Error())
+				continue
+			}
+			pingsSent++
+		case ev := <-events:
+			elapsed := time.Since(start).Round(time.Millisecond)
+			if ev.err != nil {
+				msg(o, "idle", vt.LightYellow.Get(describeClose(ev.err)), fmt.Sprintf("after %s, %d of %d pings answered", elapsed, pingsAckd, pingsSent))
+				if !goaway {
+					msg(o, "goaway", vt.Red.Get("None"), "the connection ended without a GOAWAY frame")
+				}
+				return
+			}
+			switch ev.frameType {
+			case http2.FrameSettings:
+				if !ev.ack {
+					rc.fr.WriteSettingsAck()
+				}
+			case http2.FramePing:
+				if ev.ack {
+					pingsAckd++
+				} else {
+					rc.fr.WritePing(true, ev.pingData)
+				}
+			case http2.FrameGoAway:
+				goaway = true
+				extra := fmt.Sprintf("after %s, last stream ID %d", elapsed, ev.lastStreamID)
+				if ev.debugData != "" {
+					extra += ", " + ev.debugData
+				}
+				msg(o, "goaway", vt.LightYellow.Get(ev.errCode.String()), extra)
+			}
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xyproto/env/v2"
+	"github.com/xyproto/vt"
+)
+
+// Import formats
+const (
+	importSitemap = "sitemap"
+	importNginx   = "nginx"
+	importCaddy   = "caddy"
+)
+
+// importedTarget is a host and port found in a sitemap or a web server configuration
+type importedTarget struct {
+	host, port string
+	h2         bool // true if the configuration says that HTTP/2 should be used
+}
+
+// Return the address of the target as host:port
+func (t *importedTarget) addr() string {
+	return net.JoinHostPort(t.host, t.port)
+}
+
+// importedTargets is a list of targets without duplicates, in the order they were found
+type importedTargets struct {
+	list []*importedTarget
+	seen map[string]*importedTarget
+}
+
+// Add a target, unless it is already there. A target is configured for
+// HTTP/2 if any of the places it is configured says so.
+func (ts *importedTargets) add(host, port string, h2 bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if ts.seen == nil {
+		ts.seen = make(map[string]*importedTarget)
+	}
+	key := net.JoinHostPort(host, port)
+	if t, ok := ts.seen[key]; ok {
+		t.h2 = t.h2 || h2
+		return
+	}
+	t := &importedTarget{host: host, port: port, h2: h2}
+	ts.seen[key] = t
+	ts.list = append(ts.list, t)
+}
+
+// The elements of sitemap.xml files and sitemap indexes
+type sitemapFile struct {
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// Import the hosts of the URLs in a sitemap. The sitemaps that a sitemap
+// index refers to are read from the same directory as the index.
+func readSitemap(filename string, ts *importedTargets, depth int) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var sm sitemapFile
+	if err := xml.Unmarshal(data, &sm); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	for _, u := range sm.URLs {
+		parsed, err := neturl.Parse(strings.TrimSpace(u.Loc))
+		if err != nil || parsed.Hostname() == "" {
+			return fmt.Errorf("%s: invalid URL %q", filename, u.Loc)
+		}
+		if parsed.Scheme != "https" {
+			continue
+		}
+		port := parsed.Port()
+		if port == "" {
+			port = "443"
+		}
+		ts.add(parsed.Hostname(), port, false)
+	}
+	if len(sm.Sitemaps) > 0 && depth > 0 {
+		return fmt.Errorf("%s: sitemap indexes can not refer to other sitemap indexes", filename)
+	}
+	for _, s := range sm.Sitemaps {
+		parsed, err := neturl.Parse(strings.TrimSpace(s.Loc))
+		if err != nil {
+			return fmt.Errorf("%s: invalid URL %q", filename, s.Loc)
+		}
+		local := filepath.Join(filepath.Dir(filename), path.Base(parsed.Path))
+		if err := readSitemap(local, ts, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Split a web server configuration into words, where "{", "}" and ";" are
+// words of their own. Comments are removed.
+func configWords(data string) []string {
+	var words []string
+	for _, line := range strings.Split(data, "\n") {
+		line = stripComment(line)
+		for _, r := range []string{"{", "}", ";"} {
+			line = strings.ReplaceAll(line, r, " "+r+" ")
+		}
+		words = append(words, strings.Fields(line)...)
+	}
+	return words
+}
+
+// Import the server names and TLS ports of the server blocks in an nginx
+// configuration. A port is configured for HTTP/2 if the listen directive
+// has the http2 parameter, or if the server block has "http2 on".
+func readNginx(filename string, ts *importedTargets) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	type listen struct {
+		port string
+		h2   bool
+	}
+	var (
+		depth       int
+		serverDepth = -1 // the depth of the current server block, or -1
+		names       []string
+		listens     []listen
+		http2On     bool
+		directive   []string
+	)
+	for _, w := range configWords(string(data)) {
+		switch w {
+		case "{":
+			if serverDepth < 0 && len(directive) == 1 && directive[0] == "server" {
+				serverDepth, names, listens, http2On = depth, nil, nil, false
+			}
+			depth++
+			directive = nil
+		case "}":
+			depth--
+			if depth == serverDepth {
+				for _, name := range names {
+					for _, l := range listens {
+						ts.add(name, l.port, l.h2 || http2On)
+					}
+				}
+				serverDepth = -1
+			}
+			directive = nil
+		case ";":
+			if serverDepth >= 0 && depth == serverDepth+1 && len(directive) > 1 {
+				switch directive[0] {
+				case "server_name":
+					for _, name := range directive[1:] {
+						// Skip catch-all names, wildcards and regular expressions
+						if name != "_" && name != `""` && !strings.ContainsAny(name, "*~") {
+							names = append(names, name)
+						}
+					}
+				case "listen":
+					l := listen{port: "80"}
+					ssl := false
+					for i, p := range directive[1:] {
+						switch {
+						case p == "ssl":
+							ssl = true
+						case p == "http2":
+							l.h2 = true
+						case i == 0:
+							if _, port, err := net.SplitHostPort(p); err == nil {
+								l.port = port
+							} else if !strings.Contains(p, ".") && !strings.HasPrefix(p, "unix:") {
+								l.port = p
+							} else {
+								l.port = "80"
+							}
+						}
+					}
+					// Only TLS ports can negotiate HTTP/2 with ALPN
+					if ssl {
+						listens = append(listens, l)
+					}
+				case "http2":
+					http2On = directive[1] == "on"
+				}
+			}
+			directive = nil
+		default:
+			directive = append(directive, w)
+		}
+	}
+	return nil
+}
+
+// Import the site addresses in a Caddyfile. Caddy serves HTTP/2 over HTTPS
+// by default, unless the global options leave out h2 from "protocols".
+func readCaddyfile(filename string, ts *importedTargets) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var (
+		h2     = true
+		depth  int
+		blocks int  // the number of top level blocks so far
+		global bool // true while in the global options block
+	)
+	for _, line := range strings.Split(string(data), "\n") {
+		text := strings.TrimSpace(stripComment(line))
+		if text == "" {
+			continue
+		}
+		if depth == 0 && strings.HasSuffix(text, "{") {
+			addresses := strings.TrimSpace(strings.TrimSuffix(text, "{"))
+			switch {
+			case addresses == "" && blocks == 0:
+				global = true
+			case strings.HasPrefix(addresses, "("):
+				// A snippet
+			default:
+				for _, a := range strings.FieldsFunc(addresses, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+					if host, port, ok := caddyAddress(a); ok {
+						ts.add(host, port, h2)
+					}
+				}
+			}
+			blocks++
+		}
+		if global && depth > 0 {
+			if fields := strings.Fields(text); len(fields) > 1 && fields[0] == "protocols" {
+				h2 = false
+				for _, p := range fields[1:] {
+					if p == "h2" {
+						h2 = true
+					}
+				}
+			}
+		}
+		depth += strings.Count(text, "{") - strings.Count(text, "}")
+		if depth == 0 {
+			global = false
+		}
+	}
+	return nil
+}
+
+// Parse a Caddyfile site address, like "example.com", "example.com:8443" or
+// "https://example.com". Returns false for addresses that are not served
+// over HTTPS or that have no host name.
+func caddyAddress(a string) (host, port string, ok bool) {
+	if strings.HasPrefix(a, "http://") {
+		return "", "", false
+	}
+	a = strings.TrimPrefix(a, "https://")
+	a, _, _ = strings.Cut(a, "/")
+	host, port = a, "443"
+	if h, p, err := net.SplitHostPort(a); err == nil {
+		host, port = h, p
+	}
+	if host == "" || strings.Contains(host, "*") || port == "80" {
+		return "", "", false
+	}
+	return host, port, true
+}
+
+// Split an --import value into a format and a filename. The format can be
+// given as a prefix, like "nginx:sites.conf", or it is guessed from the filename.
+func parseImportFlag(s string) (format, filename string) {
+	if f, name, found := strings.Cut(s, ":"); found && (f == importSitemap || f == importNginx || f == importCaddy) {
+		return f, name
+	}
+	base := strings.ToLower(filepath.Base(s))
+	switch {
+	case filepath.Ext(base) == ".xml":
+		return importSitemap, s
+	case strings.HasPrefix(base, "caddyfile") || filepath.Ext(base) == ".caddy":
+		return importCaddy, s
+	}
+	return importNginx, s
+}
+
+// Import the targets from a sitemap or web server configuration and check
+// them all. Targets that are configured for HTTP/2 but that do not
+// negotiate it are flagged. Returns the records and the exit code of the
+// first target that failed, if any.
+func runImport(o *vt.TextOutput, s string) ([]*record, int) {
+	format, filename := parseImportFlag(s)
+	filename = env.ExpandUser(filename)
+	var (
+		ts  importedTargets
+		err error
+	)
+	switch format {
+	case importSitemap:
+		err = readSitemap(filename, &ts, 0)
+	case importCaddy:
+		err = readCaddyfile(filename, &ts)
+	default:
+		err = readNginx(filename, &ts)
+	}
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	if len(ts.list) == 0 {
+		o.ErrExit(fmt.Sprintf("%s: found no HTTPS targets", filename))
+	}
+
+	o.Println(vt.DarkGray.Get("IMPORT") + " " + vt.LightCyan.Get(filename) + " " + vt.DarkGray.Get(fmt.Sprintf("(%s, %d targets)", format, len(ts.list))))
+	row := func(target, configured, proto, latency string) string {
+		return fmt.Sprintf("%-40s %-10s %-10s %9s", target, configured, proto, latency)
+	}
+	o.Println()
+	o.Println(vt.DarkGray.Get(row("target", "configured", "protocol", "latency")))
+
+	var records []*record
+	failed, mismatched, code := 0, 0, exitOK
+	for _, t := range ts.list {
+		url := "https://" + t.addr()
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+		r := check(ctx, url)
+		cancel()
+		var expect expectations
+		configured := "-"
+		if t.h2 {
+			expect.Proto = "HTTP/2.0"
+			configured = "h2"
+		}
+		rec := &record{Method: "GET", Result: r, Assertions: expect.evaluate(r)}
+		records = append(records, rec)
+
+		proto := r.Proto
+		if !r.ok() {
+			proto = r.Class
+		}
+		latency := r.Timings.Total.Round(time.Millisecond).String()
+		// The server responded, but without HTTP/2
+		reachable := r.ok() || r.Class == classNoH2 || r.Class == classTLS
+		switch {
+		case r.ok() && r.Proto == "HTTP/2.0":
+			o.Println(row(t.addr(), configured, vt.LightGreen.Get(fmt.Sprintf("%-10s", proto)), latency))
+		case t.h2 && reachable:
+			mismatched++
+			o.Println(row(t.addr(), configured, vt.Red.Get(fmt.Sprintf("%-10s", proto)), latency))
+			o.Println(vt.Red.Get("  configured for HTTP/2, but " + r.summary()))
+		default:
+			o.Println(row(t.addr(), configured, vt.LightYellow.Get(fmt.Sprintf("%-10s", proto)), latency))
+			o.Println(vt.DarkGray.Get("  " + r.summary()))
+		}
+		if c := exitCode(r, rec.passed()); c != exitOK {
+			failed++
+			if code == exitOK {
+				code = c
+			}
+		}
+	}
+	o.Println()
+	if mismatched > 0 {
+		msg(o, "summary", vt.Red.Get(fmt.Sprintf("%d of %d targets are configured for HTTP/2 but do not negotiate it", mismatched, len(ts.list))))
+	}
+	if failed > mismatched {
+		msg(o, "summary", vt.LightYellow.Get(fmt.Sprintf("%d of %d targets failed", failed-mismatched, len(ts.list))))
+	}
+	if failed == 0 {
+		msg(o, "summary", vt.LightGreen.Get(fmt.Sprintf("all %d targets use HTTP/2", len(ts.list))))
+	}
+	return records, code
+}
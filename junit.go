@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"time"
+)
+
+// The JUnit XML elements, as understood by most CI systems
+type (
+	junitSuites struct {
+		XMLName xml.Name     `xml:"testsuites"`
+		Suites  []junitSuite `xml:"testsuite"`
+	}
+	junitSuite struct {
+		Name      string      `xml:"name,attr"`
+		Tests     int         `xml:"tests,attr"`
+		Failures  int         `xml:"failures,attr"`
+		Errors    int         `xml:"errors,attr"`
+		Time      string      `xml:"time,attr"`
+		Timestamp string      `xml:"timestamp,attr"`
+		Cases     []junitCase `xml:"testcase"`
+	}
+	junitCase struct {
+		Name      string        `xml:"name,attr"`
+		ClassName string        `xml:"classname,attr"`
+		Time      string        `xml:"time,attr"`
+		Failure   *junitFailure `xml:"failure,omitempty"`
+		Error     *junitFailure `xml:"error,omitempty"`
+	}
+	junitFailure struct {
+		Message string `xml:"message,attr"`
+		Type    string `xml:"type,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// Format a duration as seconds, which is what JUnit uses
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// Write the records as a JUnit XML test suite, with one test case per target
+// and one per assertion
+func writeJUnit(filename string, records []*record) error {
+	suite := junitSuite{Name: "http2check", Timestamp: time.Now().Format("2006-01-02T15:04:05")}
+	var total time.Duration
+	for _, rec := range records {
+		r := rec.Result
+		total += r.Timings.Total
+		tc := junitCase{Name: rec.name(), ClassName: "http2check", Time: junitSeconds(r.Timings.Total)}
+		if !r.ok() {
+			// Failing to get a response at all is an error, not a failed assertion
+			tc.Error = &junitFailure{Message: r.summary(), Type: r.Class, Text: r.Message + "\n" + r.Extra}
+			suite.Errors++
+		}
+		suite.Cases = append(suite.Cases, tc)
+
+		for _, a := range rec.Assertions {
+			tc := junitCase{Name: rec.name() + " expect " + a.Name, ClassName: "http2check.expect", Time: junitSeconds(0)}
+			if !a.OK {
+				actual := a.Actual
+				if actual == "" {
+					actual = "nothing"
+				}
+				message := fmt.Sprintf("expected %s %s, got %s", a.Name, a.Expected, actual)
+				if !r.ok() {
+					message += " (" + r.summary() + ")"
+				}
+				tc.Failure = &junitFailure{Message: message, Type: "assertion", Text: message}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+	}
+	suite.Tests = len(suite.Cases)
+	suite.Time = junitSeconds(total)
+
+	data, err := xml.MarshalIndent(junitSuites{Suites: []junitSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
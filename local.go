@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/vt"
+)
+
+// The state of a listening socket in /proc/net/tcp
+const tcpListen = "0A"
+
+// listener is a listening TCP socket on this machine
+type listener struct {
+	ip      net.IP
+	port    int
+	inode   string
+	process string // the name and PID of the owning process, if readable
+}
+
+// Return the address to connect to for reaching the listener. Sockets that
+// listen on all addresses are reached on the loopback address.
+func (l *listener) dialAddr() string {
+	ip := l.ip
+	switch {
+	case ip.Equal(net.IPv4zero):
+		ip = net.IPv4(127, 0, 0, 1)
+	case ip.Equal(net.IPv6unspecified):
+		ip = net.IPv6loopback
+	}
+	return ip.String()
+}
+
+// Parse an address from /proc/net/tcp or /proc/net/tcp6, like
+// "0100007F:1F90". The IP address is stored as 32-bit words in host byte
+// order, which is little endian on x86 and ARM.
+func parseProcAddr(s string) (net.IP, int, error) {
+	ipHex, portHex, found := strings.Cut(s, ":")
+	if !found {
+		return nil, 0, fmt.Errorf("invalid address: %s", s)
+	}
+	b, err := hex.DecodeString(ipHex)
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("invalid address: %s", s)
+	}
+	for i := 0; i < len(b); i += 4 {
+		b[i], b[i+1], b[i+2], b[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid port: %s", s)
+	}
+	return net.IP(b), int(port), nil
+}
+
+// Read the listening sockets from a file like /proc/net/tcp
+func readListeners(filename string) ([]*listener, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var listeners []*listener
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // skip the header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpListen {
+			continue
+		}
+		ip, port, err := parseProcAddr(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		listeners = append(listeners, &listener{ip: ip, port: port, inode: fields[9]})
+	}
+	return listeners, scanner.Err()
+}
+
+// Find the processes that own the given socket inodes, by looking through
+// the open files of all processes. Only the processes that can be read are found.
+func socketOwners() map[string]string {
+	owners := make(map[string]string)
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		link, err := os.Readlink(fd)
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+		if _, ok := owners[inode]; ok {
+			continue
+		}
+		pid := strings.Split(fd, "/")[2]
+		comm, err := os.ReadFile(filepath.Join("/proc", pid, "comm"))
+		if err != nil {
+			continue
+		}
+		owners[inode] = strings.TrimSpace(string(comm)) + "/" + pid
+	}
+	return owners
+}
+
+// Return all the listening TCP sockets on this machine, sorted by port.
+// A socket that listens on all addresses for both IPv4 and IPv6 is only listed once.
+func localListeners() ([]*listener, error) {
+	var all []*listener
+	for _, filename := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		listeners, err := readListeners(filename)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, listeners...)
+	}
+	owners := socketOwners()
+	var unique []*listener
+	seen := make(map[string]bool)
+	for _, l := range all {
+		l.process = owners[l.inode]
+		key := net.JoinHostPort(l.dialAddr(), strconv.Itoa(l.port))
+		if l.ip.IsUnspecified() {
+			key = "*:" + strconv.Itoa(l.port)
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, l)
+	}
+	sort.SliceStable(unique, func(i, j int) bool { return unique[i].port < unique[j].port })
+	return unique, nil
+}
+
+// Find all the TCP sockets that listen on this machine and check each of
+// them for TLS with h2 and for h2c
+func runLocal(o *vt.TextOutput, concurrency int) {
+	listeners, err := localListeners()
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	if len(listeners) == 0 {
+		o.ErrExit("found no listening TCP sockets in /proc/net/tcp or /proc/net/tcp6")
+	}
+	o.Println(vt.DarkGray.Get("LOCAL") + " " + vt.LightCyan.Get(fmt.Sprintf("%d listening sockets", len(listeners))))
+
+	var targets []portTarget
+	names := make([]string, len(listeners))
+	table := &portTable{o: o, width: len("address")}
+	for i, l := range listeners {
+		targets = append(targets, portTarget{l.dialAddr(), l.port})
+		names[i] = net.JoinHostPort(l.ip.String(), strconv.Itoa(l.port))
+		table.width = max(table.width, len(names[i]))
+	}
+	results := probeAll(targets, "", concurrency)
+
+	o.Println()
+	table.header("address", "process")
+	negotiatedTLS, negotiatedH2 := 0, 0
+	for i, pr := range results {
+		if pr.tlsVersion != "" {
+			negotiatedTLS++
+		}
+		if pr.alpn == "h2" || pr.h2c {
+			negotiatedH2++
+		}
+		table.result(names[i], pr, vt.DarkGray.Get(listeners[i].process))
+	}
+	o.Println()
+	msg(o, "TLS", vt.White.Get(fmt.Sprintf("%d of %d sockets", negotiatedTLS, len(listeners))))
+	if negotiatedH2 > 0 {
+		msg(o, "HTTP/2", vt.LightGreen.Get(fmt.Sprintf("%d of %d sockets", negotiatedH2, len(listeners))))
+	} else {
+		msg(o, "HTTP/2", vt.LightYellow.Get("no sockets"))
+	}
+}
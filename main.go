@@ -1,16 +1,19 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
-	"net/http"
+	neturl "net/url"
 	"os"
 	"runtime"
 	"strings"
 
+	"github.com/xyproto/env/v2"
 	"github.com/xyproto/vt"
 	"golang.org/x/net/http2"
 )
@@ -26,6 +29,12 @@ func msg(o *vt.TextOutput, subject, msg string, extra ...string) {
 	}
 }
 
+// Output an error message and exit with the exit code for invalid flags
+func usageExit(o *vt.TextOutput, msg string) {
+	o.Err(msg)
+	os.Exit(exitUsage)
+}
+
 // We have an IPv6 addr where the URL needs to be changed from https://something to [something]:443
 func fixIPv6(url string) string {
 	port := ""
@@ -40,6 +49,151 @@ func fixIPv6(url string) string {
 	return "[" + url + "]" + port
 }
 
+// Normalize the given URL for being checked. Wraps IPv6 addresses in
+// brackets, adds https:// if no scheme is given and strips interface names
+// like "%eth0". Returns the URL and the interface name that was stripped, if any.
+func normalizeURL(url string) (string, string, error) {
+	ipaddr := net.ParseIP(url)
+	if ipaddr.DefaultMask() == nil {
+		// Not a valid IPv4 address
+		// Check if it's likely to be IPv6.
+
+		// TODO: Find a better way to detect this
+		if strings.Contains(url, "::") {
+			url = fixIPv6(url)
+		}
+	}
+	if !strings.Contains(url, "://") {
+		url = "https://" + url
+	}
+
+	/*
+	 * Enumerate the interfaces and strip strings like "%eth0",
+	 * because they are parsed incorrectly by Go, with errors like:
+	 * parse [ff02::1%!e(MISSING)th0]:443: invalid URL escape "%!e(MISSING)t"
+	 */
+	stripped := ""
+	if strings.Contains(url, "%") {
+		interfaces, err := net.Interfaces()
+		if err != nil {
+			return "", "", err
+		}
+		for _, iface := range interfaces {
+			// TODO: Find the final % and check if it is followed by an iface, instead
+			iName := "%" + iface.Name
+			if strings.Contains(url, iName) {
+				url = strings.Replace(url, iName, "", -1)
+				stripped = iName
+				break
+			}
+		}
+	}
+
+	if _, err := neturl.Parse(url); err != nil {
+		return "", "", err
+	}
+	return url, stripped, nil
+}
+
+// Prepare the given URL for being checked, or exit with an error message
+func prepareURL(o *vt.TextOutput, url string) string {
+	url, stripped, err := normalizeURL(url)
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	if stripped != "" {
+		o.Println(vt.DarkGray.Get("ignoring \"" + stripped + "\""))
+	}
+	return url
+}
+
+// How to connect, when it should differ from what the URL says
+var (
+	unixSocket string    // the Unix domain socket to connect to instead of the host, if any
+	sniName    string    // the SNI name to send instead of the host name, if any
+	noSNI      bool      // true if no SNI should be sent at all
+	hostHeader string    // the Host/:authority to use instead of the host, if any
+	keyLog     io.Writer // where to write the TLS session keys, if anywhere
+)
+
+// Return a TLS configuration that does not verify certificates, and that
+// writes the session keys to keyLog, if it is set
+func newTLSConfig(serverName string, nextProtos ...string) *tls.Config {
+	return &tls.Config{InsecureSkipVerify: true, ServerName: serverName, NextProtos: nextProtos, KeyLogWriter: keyLog}
+}
+
+// Return the SNI name to send when connecting to the given host, or an
+// empty string if no SNI should be sent
+func serverName(host string) string {
+	switch {
+	case noSNI:
+		return ""
+	case sniName != "":
+		return sniName
+	}
+	return host
+}
+
+// Connect to the given address, or to the Unix domain socket if one is set
+func dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	if unixSocket != "" {
+		return d.DialContext(ctx, "unix", unixSocket)
+	}
+	return d.DialContext(ctx, network, addr)
+}
+
+// Connect to the given address and perform a TLS handshake, sending the
+// SNI name from serverName. Fails if the server does not negotiate h2.
+func dialTLSContext(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	cfg = cfg.Clone()
+	cfg.ServerName = serverName(host)
+	tc := tls.Client(conn, cfg)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// http2.Transport only checks ALPN when it dials by itself
+	if err := checkALPN(tc, "h2"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// Check that the given protocol was negotiated with ALPN, with the same
+// error as http2.Transport gives when it dials by itself
+func checkALPN(tc *tls.Conn, want string) error {
+	if p := tc.ConnectionState().NegotiatedProtocol; p != want {
+		return fmt.Errorf("http2: unexpected ALPN protocol %q; want %q", p, want)
+	}
+	return nil
+}
+
+// Create a HTTP/2 transport that does not verify certificates
+func newTransport() *http2.Transport {
+	tlsconf := newTLSConfig("")
+	return &http2.Transport{TLSClientConfig: tlsconf, DialTLSContext: dialTLSContext}
+}
+
+// Create a HTTP/2 transport for http:// URLs, using HTTP/2 with prior knowledge (h2c)
+func newH2CTransport() *http2.Transport {
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dialContext(ctx, network, addr)
+		},
+	}
+}
+
 func main() {
 	o := vt.NewTextOutput(true, true)
 
@@ -55,9 +209,75 @@ func main() {
 
 	versionHelp := "Show application name and version"
 	quietHelp := "Don't write to standard out"
+	compareHelp := "Compare HTTP/1.1 connections with HTTP/2 multiplexing"
+	pathsHelp := "Comma separated paths to fetch when comparing"
+	connsHelp := "Number of HTTP/1.1 connections when comparing"
+	pushHelp := "Check if the server uses server push"
+	hpackHelp := "Analyze HPACK header compression"
+	pingHelp := "Measure N round trips with HTTP/2 PING frames"
+	idleHelp := "Stay idle after one request and report how the connection ends"
+	keepaliveHelp := "Send a PING at this interval while idle"
+	priorityHelp := "Check support for RFC 9218 extensible priorities"
+	websocketHelp := "Check support for WebSockets over HTTP/2 (RFC 8441)"
+	grpcHealthHelp := "Send a gRPC health check, optionally for the given service"
+	crawlHelp := "Check every origin that the page refers to in script, link, img and iframe tags"
+	portsHelp := "Scan these ports for TLS, h2 and h2c, for example 443,8443,9000-9010"
+	keylogHelp := "Append the TLS session keys to this file, for decrypting captured traffic (default $SSLKEYLOGFILE)"
+	unixSocketHelp := "Connect to this Unix domain socket instead of the host in the URL"
+	sniHelp := "Send this SNI name instead of the host name, or comma separated names to try each"
+	noSNIHelp := "Do not send SNI"
+	hostHelp := "Use this Host/:authority instead of the host name, or comma separated names to try each"
+	concurrencyHelp := "How many addresses to check at the same time in a CIDR range or with --local"
+	localHelp := "Check every TCP socket that listens on this machine for TLS, h2 and h2c"
+	watchHelp := "Check again at this interval, and print only changes"
+	exitOnRegressionHelp := "Exit with a non-zero code on the first regression when watching"
+	configHelp := "Check the targets in a YAML or TOML configuration file"
+	importHelp := "Check the targets in a sitemap.xml, nginx configuration or Caddyfile"
+	expectProtoHelp := "Fail unless this protocol is used, for example HTTP/2.0"
+	expectStatusHelp := "Fail unless the status matches, for example 200, 2xx or 200,301"
+	maxLatencyHelp := "Fail if the check takes longer than this"
+	minTLSHelp := "Fail if the TLS version is lower than this, for example 1.3"
+	junitHelp := "Write a JUnit XML report to this file"
+	reportHelp := "Write an HTML or Markdown report, as html:FILE, md:FILE or FILE.html or FILE.md"
+	jsonHelp := "Write the results to a JSON file, for comparing runs with \"http2check diff\""
+	harHelp := "Write the requests and responses to a HAR file, for browser devtools and HAR viewers"
 
 	version := flag.Bool("version", false, versionHelp)
 	quiet := flag.Bool("q", false, quietHelp)
+	compare := flag.Bool("compare", false, compareHelp)
+	paths := flag.String("paths", "/", pathsHelp)
+	conns := flag.Int("conns", 6, connsHelp)
+	push := flag.Bool("push", false, pushHelp)
+	hpackStats := flag.Bool("hpack-stats", false, hpackHelp)
+	ping := flag.Int("ping", 0, pingHelp)
+	idle := flag.Duration("idle", 0, idleHelp)
+	keepalive := flag.Duration("keepalive", 0, keepaliveHelp)
+	priority := flag.Bool("priority", false, priorityHelp)
+	websocket := flag.Bool("websocket", false, websocketHelp)
+	var grpcHealth grpcHealthFlag
+	flag.Var(&grpcHealth, "grpc-health", grpcHealthHelp)
+	crawl := flag.Bool("crawl", false, crawlHelp)
+	ports := flag.String("ports", "", portsHelp)
+	keylog := flag.String("keylog", env.Str("SSLKEYLOGFILE"), keylogHelp)
+	flag.StringVar(&unixSocket, "unix-socket", "", unixSocketHelp)
+	sni := flag.String("sni", "", sniHelp)
+	flag.BoolVar(&noSNI, "no-sni", false, noSNIHelp)
+	host := flag.String("host", "", hostHelp)
+	concurrency := flag.Int("concurrency", 32, concurrencyHelp)
+	local := flag.Bool("local", false, localHelp)
+	watch := flag.Duration("watch", 0, watchHelp)
+	exitOnRegression := flag.Bool("exit-on-regression", false, exitOnRegressionHelp)
+	config := flag.String("config", "", configHelp)
+	importFile := flag.String("import", "", importHelp)
+	expectProto := flag.String("expect-proto", "", expectProtoHelp)
+	expectStatus := flag.String("expect-status", "", expectStatusHelp)
+	maxLatency := flag.Duration("max-latency", 0, maxLatencyHelp)
+	minTLS := flag.String("min-tls", "", minTLSHelp)
+	var reports reportFiles
+	flag.StringVar(&reports.junit, "junit", "", junitHelp)
+	flag.StringVar(&reports.report, "report", "", reportHelp)
+	flag.StringVar(&reports.json, "json", "", jsonHelp)
+	flag.StringVar(&reports.har, "har", "", harHelp)
 
 	flag.Usage = func() {
 		fmt.Println()
@@ -65,12 +285,59 @@ func main() {
 		fmt.Println("Check if a given webserver is using HTTP/2")
 		fmt.Println()
 		fmt.Println("Syntax: http2check [URI]")
+		fmt.Println("        http2check unix:PATH")
+		fmt.Println("        http2check bench [flags] [URI]")
+		fmt.Println("        http2check exporter [flags]")
+		fmt.Println("        http2check diff [flags] OLD.json NEW.json")
 		fmt.Println()
 		fmt.Println("Possible flags:")
 		fmt.Println("    --version                  " + versionHelp)
 		fmt.Println("    --q                        " + quietHelp)
+		fmt.Println("    --compare                  " + compareHelp)
+		fmt.Println("    --paths PATHS              " + pathsHelp)
+		fmt.Println("    --conns N                  " + connsHelp)
+		fmt.Println("    --push                     " + pushHelp)
+		fmt.Println("    --hpack-stats              " + hpackHelp)
+		fmt.Println("    --ping N                   " + pingHelp)
+		fmt.Println("    --idle DURATION            " + idleHelp)
+		fmt.Println("    --keepalive DURATION       " + keepaliveHelp)
+		fmt.Println("    --priority                 " + priorityHelp)
+		fmt.Println("    --websocket                " + websocketHelp)
+		fmt.Println("    --grpc-health[=SERVICE]    " + grpcHealthHelp)
+		fmt.Println("    --crawl                    " + crawlHelp)
+		fmt.Println("    --ports PORTS              " + portsHelp)
+		fmt.Println("    --keylog FILE              " + keylogHelp)
+		fmt.Println("    --unix-socket PATH         " + unixSocketHelp)
+		fmt.Println("    --sni NAME                 " + sniHelp)
+		fmt.Println("    --no-sni                   " + noSNIHelp)
+		fmt.Println("    --host NAME                " + hostHelp)
+		fmt.Println("    --concurrency N            " + concurrencyHelp)
+		fmt.Println("    --local                    " + localHelp)
+		fmt.Println("    --watch DURATION           " + watchHelp)
+		fmt.Println("    --exit-on-regression       " + exitOnRegressionHelp)
+		fmt.Println("    --config FILE              " + configHelp)
+		fmt.Println("    --import [FORMAT:]FILE     " + importHelp)
+		fmt.Println("    --expect-proto PROTO       " + expectProtoHelp)
+		fmt.Println("    --expect-status STATUS     " + expectStatusHelp)
+		fmt.Println("    --max-latency DURATION     " + maxLatencyHelp)
+		fmt.Println("    --min-tls VERSION          " + minTLSHelp)
+		fmt.Println("    --junit FILE               " + junitHelp)
+		fmt.Println("    --report FORMAT:FILE       " + reportHelp)
+		fmt.Println("    --json FILE                " + jsonHelp)
+		fmt.Println("    --har FILE                 " + harHelp)
 		fmt.Println("    --help                     This text")
 		fmt.Println()
+		fmt.Println("Exit codes:")
+		fmt.Println("    0                          Success")
+		fmt.Println("    1                          Other error")
+		fmt.Println("    2                          Invalid flags or flag values")
+		fmt.Println("    3                          Host name could not be resolved")
+		fmt.Println("    4                          Connection failed")
+		fmt.Println("    5                          TLS handshake failed")
+		fmt.Println("    6                          HTTP/2 is not supported")
+		fmt.Println("    7                          An expectation was not met")
+		fmt.Println("    8                          Timeout")
+		fmt.Println()
 	}
 
 	flag.Parse()
@@ -84,97 +351,193 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Check the flag values before anything is sent
+	expect := expectations{Proto: *expectProto, Status: *expectStatus, MaxLatency: *maxLatency}
+	if *minTLS != "" {
+		v, err := parseTLSVersion(*minTLS)
+		if err != nil {
+			usageExit(o, err.Error())
+		}
+		expect.MinTLS = v
+	}
+	if *conns < 1 {
+		usageExit(o, "--conns must be at least 1")
+	}
+	if *concurrency < 1 {
+		usageExit(o, "--concurrency must be at least 1")
+	}
+	var portList []int
+	if *ports != "" {
+		var err error
+		if portList, err = parsePorts(*ports); err != nil {
+			usageExit(o, err.Error())
+		}
+	}
+	if reports.report != "" {
+		if _, _, err := parseReportFlag(reports.report); err != nil {
+			usageExit(o, err.Error())
+		}
+	}
+
+	// Write the TLS session keys in the NSS key log format, which Wireshark can read
+	if *keylog != "" {
+		f, err := os.OpenFile(env.ExpandUser(*keylog), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			o.ErrExit(err.Error())
+		}
+		defer f.Close()
+		keyLog = f
+		o.Println(vt.DarkGray.Get("writing TLS keys to " + *keylog))
+	}
+
 	// Retrieve the commandline arguments
 	args := flag.Args()
 
+	// Check if a subcommand was given
+	if len(args) > 0 {
+		switch args[0] {
+		case "bench":
+			runBench(o, args[1:])
+			return
+		case "exporter":
+			runExporter(o, args[1:])
+			return
+		case "diff":
+			runDiff(o, args[1:])
+			return
+		}
+	}
+
+	if *config != "" {
+		records, code := runConfig(o, *config)
+		reports.write(o, records)
+		os.Exit(code)
+	}
+
+	if *importFile != "" {
+		records, code := runImport(o, *importFile)
+		reports.write(o, records)
+		os.Exit(code)
+	}
+
+	if *local {
+		runLocal(o, *concurrency)
+		return
+	}
+
 	// The default URL
 	url := "https://twitter.com"
 	if len(args) > 0 {
 		url = args[0]
 	}
-	ipaddr := net.ParseIP(url)
-	if ipaddr.DefaultMask() == nil {
-		// Not a valid IPv4 address
-		// Check if it's likely to be IPv6.
 
-		// TODO: Find a better way to detect this
-		if strings.Contains(url, "::") {
-			url = fixIPv6(url)
-		}
-	}
-	if !strings.Contains(url, "://") {
-		url = "https://" + url
+	// Connect to a Unix domain socket, using h2c, with a target like unix:/run/app.sock
+	if path, found := strings.CutPrefix(url, "unix:"); found {
+		unixSocket = strings.TrimPrefix(path, "//")
+		url = "http://localhost"
 	}
 
-	/*
-	 * Enumerate the interfaces and strip strings like "%eth0",
-	 * because they are parsed incorrectly by Go, with errors like:
-	 * parse [ff02::1%!e(MISSING)th0]:443: invalid URL escape "%!e(MISSING)t"
-	 */
-	interfaces, err := net.Interfaces()
+	// Check every address in a CIDR range, like 10.20.0.0/24:443
+	network, port, isCIDR, err := parseCIDRTarget(url)
 	if err != nil {
-		o.ErrExit(err.Error())
+		usageExit(o, err.Error())
 	}
-	for _, iface := range interfaces {
-		// TODO: Find the final % and check if it is followed by an iface, instead
-		iName := "%" + iface.Name
-		if strings.Contains(url, iName) {
-			o.Println(vt.DarkGray.Get("ignoring \"" + iName + "\""))
-			url = strings.Replace(url, iName, "", -1)
-			break
-		}
+	if isCIDR {
+		sniName = *sni
+		runCIDR(o, network, port, serverName(""), *concurrency)
+		return
 	}
 
-	// Display the URL that is about be checked
-	o.Println(vt.DarkGray.Get("GET") + " " + vt.LightCyan.Get(url))
+	url = prepareURL(o, url)
 
-	// GET over HTTP/2
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		if strings.HasSuffix(err.Error(), "hexadecimal escape in host") {
-			url = fixIPv6(url)
-		} else {
-			o.ErrExit(err.Error())
-		}
+	// Send another SNI name or Host/:authority than the URL says
+	snis, hosts := splitList(*sni), splitList(*host)
+	if noSNI {
+		snis = append(snis, "")
 	}
-	tlsconf := &tls.Config{InsecureSkipVerify: true}
-	rt := &http2.Transport{TLSClientConfig: tlsconf}
-	res, err := rt.RoundTrip(req)
-	if err != nil {
-		// Pick up typical problems with IPv6 addresses
-		// TODO: Find an exact way to do this instead
-		if strings.Contains(err.Error(), "too many colons") {
-			url = fixIPv6(url)
-			o.Println(vt.LightYellow.Get("IPv6") + " " + vt.DarkGray.Get(url))
-			req, err = http.NewRequest("GET", url, nil)
-			if err != nil {
-				o.ErrExit(err.Error())
-			}
-			res, err = rt.RoundTrip(req)
-		}
-		if err != nil {
-			// Better looking error messages
-			errorMessage := strings.TrimSpace(err.Error())
-			if errorMessage == "bad protocol:" {
-				msg(o, "protocol", vt.Red.Get("Not HTTP/2"))
-			} else if errorMessage == "http2: unsupported scheme and no Fallback" {
-				msg(o, "HTTP/2", vt.Red.Get("Not supported"))
-			} else if strings.HasPrefix(errorMessage, "dial tcp") && strings.HasSuffix(errorMessage, ": connection refused") {
-				msg(o, "host", vt.Red.Get("Down"), errorMessage)
-			} else if strings.HasPrefix(errorMessage, "tls: oversized record received with length ") {
-				msg(o, "protocol", vt.Red.Get("No HTTPS support"), errorMessage)
-			} else if strings.HasPrefix(errorMessage, "http2: unexpected ALPN protocol") {
-				msg(o, "protocol", vt.Red.Get("Not HTTP/2"))
-			} else if strings.HasPrefix(errorMessage, "dial tcp: lookup") {
-				msg(o, "host", vt.Red.Get("Down"), "host not found")
-			} else {
-				o.ErrExit(errorMessage)
-			}
-			os.Exit(1)
-		}
+	if len(snis) == 1 {
+		sniName = snis[0]
+	}
+	if len(hosts) == 1 {
+		hostHeader = hosts[0]
+	}
+
+	if *compare {
+		runCompare(o, url, strings.Split(*paths, ","), *conns)
+		return
+	}
+
+	if *push {
+		runPush(o, url)
+		return
+	}
+
+	if *hpackStats {
+		runHPACKStats(o, url)
+		return
+	}
+
+	if *ping > 0 {
+		runPing(o, url, *ping)
+		return
+	}
+
+	if *idle > 0 {
+		runIdle(o, url, *idle, *keepalive)
+		return
+	}
+
+	if *priority {
+		runPriority(o, url)
+		return
+	}
+
+	if *websocket {
+		runWebSocket(o, url)
+		return
+	}
+
+	if grpcHealth.enabled {
+		runGRPCHealth(o, url, grpcHealth.service)
+		return
+	}
+
+	if *crawl {
+		runCrawl(o, url)
+		return
+	}
+
+	if len(portList) > 0 {
+		runPorts(o, url, portList)
+		return
+	}
+
+	if *watch > 0 {
+		runWatch(o, url, *watch, *exitOnRegression)
+		return
+	}
+
+	// Only show a table when there is more than one combination to check
+	if len(snis) > 1 || len(hosts) > 1 {
+		records, code := runOverrides(o, url, snis, hosts, expect)
+		reports.write(o, records)
+		os.Exit(code)
+	}
+
+	// Display the URL that is about be checked
+	if unixSocket != "" {
+		o.Println(vt.DarkGray.Get("GET") + " " + vt.LightCyan.Get(url) + " " + vt.DarkGray.Get("via "+unixSocket))
+	} else {
+		o.Println(vt.DarkGray.Get("GET") + " " + vt.LightCyan.Get(url))
 	}
 
-	// The final output
-	msg(o, "protocol", vt.White.Get(res.Proto))
-	msg(o, "status", vt.White.Get(res.Status))
+	// GET over HTTP/2, and display the results
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	result := check(ctx, url)
+	cancel()
+	printResult(o, result)
+	rec := newRecord("GET", result, expect.evaluate(result))
+	passed := printAssertions(o, rec.Assertions)
+	reports.write(o, []*record{rec})
+	os.Exit(exitCode(result, passed))
 }
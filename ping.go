@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	neturl "net/url"
+	"time"
+
+	"github.com/xyproto/vt"
+)
+
+// Open one HTTP/2 connection and measure the round trip time of n PING frames
+func probePing(url string, n int) ([]time.Duration, error) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialH2(u)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := newTransport().NewClientConn(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	defer cc.Close()
+
+	rtts := make([]time.Duration, 0, n)
+	for i := 0; i < n; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), rawTimeout)
+		start := time.Now()
+		err := cc.Ping(ctx)
+		rtt := time.Since(start)
+		cancel()
+		if err != nil {
+			return rtts, err
+		}
+		rtts = append(rtts, rtt)
+	}
+	return rtts, nil
+}
+
+// Return the minimum, average and maximum of the given durations, and the
+// jitter, which is the average difference between consecutive durations
+func pingStats(rtts []time.Duration) (lo, avg, hi, jitter time.Duration) {
+	lo, hi = rtts[0], rtts[0]
+	var sum, diffs time.Duration
+	for i, d := range rtts {
+		sum += d
+		if d < lo {
+			lo = d
+		}
+		if d > hi {
+			hi = d
+		}
+		if i > 0 {
+			diff := d - rtts[i-1]
+			if diff < 0 {
+				diff = -diff
+			}
+			diffs += diff
+		}
+	}
+	avg = sum / time.Duration(len(rtts))
+	if len(rtts) > 1 {
+		jitter = diffs / time.Duration(len(rtts)-1)
+	}
+	return lo, avg, hi, jitter
+}
+
+// Measure HTTP/2 PING round trips and print the results
+func runPing(o *vt.TextOutput, url string, n int) {
+	o.Println(vt.DarkGray.Get("PING") + " " + vt.LightCyan.Get(url))
+	rtts, err := probePing(url, n)
+	for i, rtt := range rtts {
+		msg(o, fmt.Sprintf("ping %d", i+1), vt.White.Get(rtt.String()))
+	}
+	if err != nil {
+		if len(rtts) == 0 {
+			o.ErrExit(err.Error())
+		}
+		msg(o, "error", vt.Red.Get(err.Error()))
+	}
+	lo, avg, hi, jitter := pingStats(rtts)
+	msg(o, "rtt", vt.White.Get(fmt.Sprintf("min %s, avg %s, max %s", lo, avg, hi)), fmt.Sprintf("jitter %s", jitter))
+}
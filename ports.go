@@ -0,0 +1,215 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xyproto/vt"
+)
+
+const (
+	// How long each step of a port scan may take
+	portTimeout = 3 * time.Second
+
+	// How many ports are scanned at the same time, by default
+	portConcurrency = 16
+
+	// The largest number of ports that can be scanned at once
+	maxPorts = 1024
+)
+
+// portResult is what was found on one port
+type portResult struct {
+	port       int
+	open       bool   // true if a TCP connection could be made
+	tlsVersion string // the TLS version, if the TLS handshake succeeded
+	alpn       string // the negotiated ALPN protocol, if any
+	h2c        bool   // true if the port speaks HTTP/2 with prior knowledge
+}
+
+// Parse a list of ports like "443,8443,9000-9010"
+func parsePorts(s string) ([]int, error) {
+	var ports []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port: %s", part)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(last); err != nil {
+				return nil, fmt.Errorf("invalid port range: %s", part)
+			}
+		}
+		if from < 1 || to > 65535 || from > to {
+			return nil, fmt.Errorf("invalid port range: %s", part)
+		}
+		for p := from; p <= to; p++ {
+			ports = append(ports, p)
+		}
+		if len(ports) > maxPorts {
+			return nil, fmt.Errorf("too many ports, the maximum is %d", maxPorts)
+		}
+	}
+	if len(ports) == 0 {
+		return nil, errors.New("no ports given")
+	}
+	return ports, nil
+}
+
+// Check if the server at the given address speaks HTTP/2 with prior knowledge
+func probeH2C(addr string) bool {
+	rc, err := dialRaw("http://" + addr)
+	if err != nil {
+		return false
+	}
+	defer rc.Close()
+	rc.conn.SetDeadline(time.Now().Add(portTimeout))
+	return rc.readSettings() == nil
+}
+
+// Find out if the given port is open, if it speaks TLS and which protocol
+// it negotiates with ALPN, or if it speaks h2c if it does not speak TLS.
+// The SNI name may be empty, for not sending SNI.
+func probePort(host, sni string, port int) *portResult {
+	pr := &portResult{port: port}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	conn, err := net.DialTimeout("tcp", addr, portTimeout)
+	if err != nil {
+		return pr
+	}
+	pr.open = true
+	tc := tls.Client(conn, newTLSConfig(sni, "h2", "http/1.1"))
+	tc.SetDeadline(time.Now().Add(portTimeout))
+	err = tc.Handshake()
+	conn.Close()
+	if err == nil {
+		state := tc.ConnectionState()
+		pr.tlsVersion = tls.VersionName(state.Version)
+		pr.alpn = state.NegotiatedProtocol
+		return pr
+	}
+	pr.h2c = probeH2C(addr)
+	return pr
+}
+
+// portTarget is an address and a port to probe
+type portTarget struct {
+	host string
+	port int
+}
+
+// Probe all the given targets, with at most the given number of probes at
+// the same time. The results are in the same order as the targets.
+func probeAll(targets []portTarget, sni string, concurrency int) []*portResult {
+	results := make([]*portResult, len(targets))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(concurrency, 1))
+	for i, t := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, t portTarget) {
+			defer wg.Done()
+			results[i] = probePort(t.host, sni, t.port)
+			<-sem
+		}(i, t)
+	}
+	wg.Wait()
+	return results
+}
+
+// portTable prints port results as a table, where the first column is
+// either the port or the address
+type portTable struct {
+	o     *vt.TextOutput
+	width int // the width of the first column
+}
+
+// Print one row
+func (t *portTable) row(first, open, tlsVersion, h2, h2c, alpn, note string) {
+	t.o.Println(strings.TrimRight(fmt.Sprintf("%-*s %-6s %-10s %-10s %-10s %-10s %s", t.width, first, open, tlsVersion, h2, h2c, alpn, note), " "))
+}
+
+// Print the column names, and the name of the last column, if there is one
+func (t *portTable) header(first string, last ...string) {
+	t.o.Println(vt.DarkGray.Get(strings.TrimRight(fmt.Sprintf("%-*s %-6s %-10s %-10s %-10s %-10s %s", t.width, first, "open", "TLS", "h2", "h2c", "ALPN", strings.Join(last, "")), " ")))
+}
+
+// Print one result, with a note in the last column
+func (t *portTable) result(first string, pr *portResult, note string) {
+	yes, no := vt.LightGreen.Get(fmt.Sprintf("%-10s", "yes")), vt.DarkGray.Get(fmt.Sprintf("%-10s", "-"))
+	mark := func(b bool) string {
+		if b {
+			return yes
+		}
+		return no
+	}
+	if !pr.open {
+		t.row(first, vt.Red.Get("no    "), no, no, no, "", note)
+		return
+	}
+	alpn := pr.alpn
+	if note != "" {
+		alpn = fmt.Sprintf("%-10s", alpn)
+	}
+	tlsVersion := no
+	if pr.tlsVersion != "" {
+		tlsVersion = vt.White.Get(fmt.Sprintf("%-10s", pr.tlsVersion))
+	}
+	t.row(first, vt.LightGreen.Get("yes   "), tlsVersion, mark(pr.alpn == "h2"), mark(pr.h2c), vt.DarkGray.Get(alpn), note)
+}
+
+// Scan the given ports on the host in the URL and print a matrix of which
+// ports speak TLS, h2 and h2c
+func runPorts(o *vt.TextOutput, url string, ports []int) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	host := u.Hostname()
+
+	o.Println(vt.DarkGray.Get("PORTS") + " " + vt.LightCyan.Get(host) + " " + vt.DarkGray.Get(fmt.Sprintf("(%d ports)", len(ports))))
+
+	var targets []portTarget
+	for _, port := range ports {
+		targets = append(targets, portTarget{host, port})
+	}
+	results := probeAll(targets, serverName(host), portConcurrency)
+
+	table := &portTable{o: o, width: 6}
+	o.Println()
+	table.header("port")
+	closed, h2Ports := 0, 0
+	for _, pr := range results {
+		if !pr.open {
+			closed++
+			// Only list closed ports when there are few of them
+			if len(ports) > 16 {
+				continue
+			}
+		}
+		if pr.alpn == "h2" || pr.h2c {
+			h2Ports++
+		}
+		table.result(strconv.Itoa(pr.port), pr, "")
+	}
+	o.Println()
+	msg(o, "ports", vt.White.Get(fmt.Sprintf("%d open", len(ports)-closed)), fmt.Sprintf("%d closed", closed))
+	if h2Ports > 0 {
+		msg(o, "HTTP/2", vt.LightGreen.Get(fmt.Sprintf("%d ports", h2Ports)))
+	} else {
+		msg(o, "HTTP/2", vt.LightYellow.Get("no ports"))
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	neturl "net/url"
+
+	"github.com/xyproto/vt"
+	"golang.org/x/net/http2"
+)
+
+// SETTINGS_NO_RFC7540_PRIORITIES, from RFC 9218
+const settingNoRFC7540Priorities http2.SettingID = 0x9
+
+// The PRIORITY_UPDATE frame type, from RFC 9218
+const framePriorityUpdate http2.FrameType = 0x10
+
+// The priority that is requested when probing, urgency 1 and incremental
+const priorityValue = "u=1, i"
+
+// Send a PRIORITY_UPDATE frame for the given stream
+func writePriorityUpdate(fr *http2.Framer, streamID uint32, value string) error {
+	payload := make([]byte, 4, 4+len(value))
+	binary.BigEndian.PutUint32(payload, streamID&0x7fffffff)
+	payload = append(payload, value...)
+	return fr.WriteRawFrame(framePriorityUpdate, 0, 0, payload)
+}
+
+// priorityResult is the outcome of probing for RFC 9218 and RFC 7540 priorities
+type priorityResult struct {
+	noRFC7540  uint32 // the value of SETTINGS_NO_RFC7540_PRIORITIES
+	hasSetting bool   // true if the server sent SETTINGS_NO_RFC7540_PRIORITIES
+	response   string // the priority response header, if any
+	err        error  // the error from sending a PRIORITY_UPDATE and priority header
+	legacyErr  error  // the error from sending an RFC 7540 PRIORITY frame
+}
+
+// Request the given URL with a priority header and a PRIORITY_UPDATE frame,
+// and then on a separate connection with a legacy PRIORITY frame
+func probePriority(url string) (*priorityResult, error) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	result := &priorityResult{}
+
+	// RFC 9218 extensible priorities
+	rc, err := dialRaw(url, http2.Setting{ID: settingNoRFC7540Priorities, Val: 1})
+	if err != nil {
+		return nil, err
+	}
+	id := rc.nextStreamID()
+	if err := writePriorityUpdate(rc.fr, id, priorityValue); err != nil {
+		rc.Close()
+		return nil, err
+	}
+	err = rc.fr.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      id,
+		BlockFragment: rc.encodeHeaders("GET", u.RequestURI(), "priority", priorityValue),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	fields, err := readResponseHeaders(rc, id)
+	result.err = err
+	result.response = headerValue(fields, "priority")
+	result.noRFC7540, result.hasSetting = rc.settings[settingNoRFC7540Priorities]
+	rc.Close()
+
+	// RFC 7540 priorities, where the second stream depends on the first one
+	rc, err = dialRaw(url)
+	if err != nil {
+		return result, err
+	}
+	defer rc.Close()
+	first, err := rc.request("GET", u.RequestURI(), true)
+	if err != nil {
+		return result, err
+	}
+	if _, err := readResponseHeaders(rc, first); err != nil {
+		result.legacyErr = err
+		return result, nil
+	}
+	second := rc.nextStreamID()
+	if err := rc.fr.WritePriority(second, http2.PriorityParam{StreamDep: first, Weight: 255}); err != nil {
+		return result, err
+	}
+	err = rc.fr.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      second,
+		BlockFragment: rc.encodeHeaders("GET", u.RequestURI()),
+		EndStream:     true,
+		EndHeaders:    true,
+		Priority:      http2.PriorityParam{StreamDep: first, Weight: 15},
+	})
+	if err != nil {
+		return result, err
+	}
+	_, result.legacyErr = readResponseHeaders(rc, second)
+	return result, nil
+}
+
+// Check if the server supports RFC 9218 extensible priorities and how it
+// handles RFC 7540 PRIORITY frames
+func runPriority(o *vt.TextOutput, url string) {
+	o.Println(vt.DarkGray.Get("PRIORITY") + " " + vt.LightCyan.Get(url))
+	result, err := probePriority(url)
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+
+	switch {
+	case !result.hasSetting:
+		msg(o, "setting", vt.White.Get("SETTINGS_NO_RFC7540_PRIORITIES not sent"))
+	case result.noRFC7540 == 1:
+		msg(o, "setting", vt.LightGreen.Get("SETTINGS_NO_RFC7540_PRIORITIES = 1"), "RFC 7540 priorities are disabled")
+	default:
+		msg(o, "setting", vt.White.Get(fmt.Sprintf("SETTINGS_NO_RFC7540_PRIORITIES = %d", result.noRFC7540)))
+	}
+
+	switch {
+	case result.err != nil:
+		msg(o, "RFC 9218", vt.Red.Get("Errored"), result.err.Error())
+	case result.response != "":
+		msg(o, "RFC 9218", vt.LightGreen.Get("Acknowledged"), "priority: "+result.response)
+	case result.hasSetting && result.noRFC7540 == 1:
+		msg(o, "RFC 9218", vt.LightGreen.Get("Acknowledged"), "by setting")
+	default:
+		msg(o, "RFC 9218", vt.LightYellow.Get("Ignored"), "no error, but no sign of support")
+	}
+
+	if result.legacyErr != nil {
+		msg(o, "RFC 7540", vt.Red.Get("Errored"), result.legacyErr.Error())
+	} else {
+		msg(o, "RFC 7540", vt.White.Get("PRIORITY frames accepted"))
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	neturl "net/url"
+
+	"github.com/xyproto/vt"
+	"golang.org/x/net/http2"
+)
+
+// Request the given URL over a connection that has server push enabled,
+// and return the paths of the resources the server promises to push.
+func probePush(url string) ([]string, error) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := dialRaw(url, http2.Setting{ID: http2.SettingEnablePush, Val: 1})
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	id, err := rc.request("GET", u.RequestURI(), true)
+	if err != nil {
+		return nil, err
+	}
+
+	var promised []string
+	for {
+		f, err := rc.readFrame()
+		if err != nil {
+			return promised, err
+		}
+		switch f := f.(type) {
+		case *http2.PushPromiseFrame:
+			block, err := rc.readHeaderBlock(f.HeaderBlockFragment(), f.HeadersEnded())
+			if err != nil {
+				return promised, err
+			}
+			fields, err := rc.dec.DecodeFull(block)
+			if err != nil {
+				return promised, err
+			}
+			promised = append(promised, headerValue(fields, ":path"))
+			// Only the promise is interesting, not the pushed resource itself
+			if err := rc.fr.WriteRSTStream(f.PromiseID, http2.ErrCodeCancel); err != nil {
+				return promised, err
+			}
+		case *http2.HeadersFrame:
+			// Keep the HPACK decoder in sync, even for frames that are not inspected
+			block, err := rc.readHeaderBlock(f.HeaderBlockFragment(), f.HeadersEnded())
+			if err != nil {
+				return promised, err
+			}
+			if _, err := rc.dec.DecodeFull(block); err != nil {
+				return promised, err
+			}
+			if f.StreamID == id && f.StreamEnded() {
+				return promised, nil
+			}
+		case *http2.DataFrame:
+			if f.StreamID == id && f.StreamEnded() {
+				return promised, nil
+			}
+		case *http2.RSTStreamFrame:
+			if f.StreamID == id {
+				return promised, errors.New("stream reset: " + f.ErrCode.String())
+			}
+		case *http2.GoAwayFrame:
+			return promised, errors.New("GOAWAY received: " + f.ErrCode.String())
+		}
+	}
+}
+
+// Check if the server uses server push, and list the promised paths
+func runPush(o *vt.TextOutput, url string) {
+	o.Println(vt.DarkGray.Get("PUSH") + " " + vt.LightCyan.Get(url))
+	promised, err := probePush(url)
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	if len(promised) == 0 {
+		msg(o, "push", vt.LightGreen.Get("Not used"))
+		return
+	}
+	msg(o, "push", vt.LightYellow.Get("Used"), fmt.Sprintf("%d promised", len(promised)))
+	for _, p := range promised {
+		msg(o, "promised", vt.White.Get(p))
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// How long a raw probe may wait for the server before giving up
+const rawTimeout = 10 * time.Second
+
+// The connection level window that raw connections advertise, so that
+// probes do not have to care about flow control
+const rawWindowSize = 1 << 30
+
+// rawConn is an HTTP/2 client connection that is driven frame by frame,
+// for probing features that http2.Transport does not expose
+type rawConn struct {
+	conn     net.Conn
+	fr       *http2.Framer
+	enc      *hpack.Encoder
+	encBuf   bytes.Buffer
+	dec      *hpack.Decoder
+	url      *neturl.URL
+	settings map[http2.SettingID]uint32 // the settings received from the server
+	streamID uint32                     // the last stream ID that was used
+}
+
+// Return host:port for the given URL, using the default port for the scheme if none is given
+func hostPort(u *neturl.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "http" {
+		return net.JoinHostPort(u.Hostname(), "80")
+	}
+	return net.JoinHostPort(u.Hostname(), "443")
+}
+
+// Connect to the server in the given URL and return a connection that is
+// ready for HTTP/2. https:// URLs must negotiate h2 with ALPN, while
+// http:// URLs are used for HTTP/2 with prior knowledge (h2c).
+func dialH2(u *neturl.URL) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rawTimeout)
+	defer cancel()
+	conn, err := dialContext(ctx, "tcp", hostPort(u))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" {
+		return conn, nil
+	}
+	tc := tls.Client(conn, newTLSConfig(serverName(u.Hostname()), "h2"))
+	tc.SetDeadline(time.Now().Add(rawTimeout))
+	if err := tc.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tc.SetDeadline(time.Time{})
+	if p := tc.ConnectionState().NegotiatedProtocol; p != "h2" {
+		conn.Close()
+		return nil, fmt.Errorf("http2: unexpected ALPN protocol %q; want %q", p, "h2")
+	}
+	return tc, nil
+}
+
+// Connect to the server in the given URL and send the connection preface
+// with the given settings. Server push is disabled unless the settings
+// enable it.
+func dialRaw(url string, settings ...http2.Setting) (*rawConn, error) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialH2(u)
+	if err != nil {
+		return nil, err
+	}
+	rc := &rawConn{
+		conn:     conn,
+		fr:       http2.NewFramer(conn, conn),
+		dec:      hpack.NewDecoder(4096, nil),
+		url:      u,
+		settings: make(map[http2.SettingID]uint32),
+	}
+	rc.enc = hpack.NewEncoder(&rc.encBuf)
+	rc.fr.MaxHeaderListSize = 1 << 20
+	rc.conn.SetDeadline(time.Now().Add(rawTimeout))
+	if _, err := conn.Write([]byte(http2.ClientPreface)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// Server push is disabled unless it is asked for, since pushed header
+	// blocks would change the HPACK decoder state behind the back of the probes
+	pushSet := false
+	for _, s := range settings {
+		pushSet = pushSet || s.ID == http2.SettingEnablePush
+	}
+	if !pushSet {
+		settings = append(settings, http2.Setting{ID: http2.SettingEnablePush, Val: 0})
+	}
+	settings = append(settings, http2.Setting{ID: http2.SettingInitialWindowSize, Val: rawWindowSize})
+	if err := rc.fr.WriteSettings(settings...); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := rc.fr.WriteWindowUpdate(0, rawWindowSize-65535); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return rc, nil
+}
+
+// Close the connection
+func (rc *rawConn) Close() error {
+	return rc.conn.Close()
+}
+
+// Return the next unused client stream ID
+func (rc *rawConn) nextStreamID() uint32 {
+	if rc.streamID == 0 {
+		rc.streamID = 1
+	} else {
+		rc.streamID += 2
+	}
+	return rc.streamID
+}
+
+// Encode a header block with the pseudo headers for the given method and
+// path, followed by the given extra headers (as name, value pairs)
+func (rc *rawConn) encodeHeaders(method, path string, extra ...string) []byte {
+	rc.encBuf.Reset()
+	rc.enc.WriteField(hpack.HeaderField{Name: ":method", Value: method})
+	rc.enc.WriteField(hpack.HeaderField{Name: ":scheme", Value: rc.url.Scheme})
+	authority := rc.url.Host
+	if hostHeader != "" {
+		authority = hostHeader
+	}
+	rc.enc.WriteField(hpack.HeaderField{Name: ":authority", Value: authority})
+	if path != "" {
+		rc.enc.WriteField(hpack.HeaderField{Name: ":path", Value: path})
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		rc.enc.WriteField(hpack.HeaderField{Name: extra[i], Value: extra[i+1]})
+	}
+	return append([]byte(nil), rc.encBuf.Bytes()...)
+}
+
+// Send a request on a new stream and return the stream ID
+func (rc *rawConn) request(method, path string, endStream bool, extra ...string) (uint32, error) {
+	id := rc.nextStreamID()
+	err := rc.fr.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      id,
+		BlockFragment: rc.encodeHeaders(method, path, extra...),
+		EndStream:     endStream,
+		EndHeaders:    true,
+	})
+	return id, err
+}
+
+// Read the next frame. SETTINGS are recorded and acknowledged and PINGs are answered.
+func (rc *rawConn) readFrame() (http2.Frame, error) {
+	f, err := rc.fr.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+	switch f := f.(type) {
+	case *http2.SettingsFrame:
+		if !f.IsAck() {
+			f.ForeachSetting(func(s http2.Setting) error {
+				rc.settings[s.ID] = s.Val
+				return nil
+			})
+			err = rc.fr.WriteSettingsAck()
+		}
+	case *http2.PingFrame:
+		if !f.IsAck() {
+			err = rc.fr.WritePing(true, f.Data)
+		}
+	}
+	return f, err
+}
+
+// Read frames until the server has sent its SETTINGS
+func (rc *rawConn) readSettings() error {
+	for {
+		f, err := rc.readFrame()
+		if err != nil {
+			return err
+		}
+		if sf, ok := f.(*http2.SettingsFrame); ok && !sf.IsAck() {
+			return nil
+		}
+	}
+}
+
+// Read the CONTINUATION frames that may follow a HEADERS or PUSH_PROMISE
+// frame, and return the complete header block
+func (rc *rawConn) readHeaderBlock(fragment []byte, endHeaders bool) ([]byte, error) {
+	block := append([]byte(nil), fragment...)
+	for !endHeaders {
+		f, err := rc.fr.ReadFrame()
+		if err != nil {
+			return nil, err
+		}
+		cf, ok := f.(*http2.ContinuationFrame)
+		if !ok {
+			return nil, errors.New("expected a CONTINUATION frame, got " + f.Header().Type.String())
+		}
+		block = append(block, cf.HeaderBlockFragment()...)
+		endHeaders = cf.HeadersEnded()
+	}
+	return block, nil
+}
+
+// Read frames until the given stream ends, and return the response header
+// fields. The header blocks that are received on the stream are also
+// counted in all the given stats.
+func readResponseHeaders(rc *rawConn, id uint32, stats ...*hpackStats) ([]hpack.HeaderField, error) {
+	var response []hpack.HeaderField
+	for {
+		f, err := rc.readFrame()
+		if err != nil {
+			return response, err
+		}
+		switch f := f.(type) {
+		case *http2.HeadersFrame:
+			block, err := rc.readHeaderBlock(f.HeaderBlockFragment(), f.HeadersEnded())
+			if err != nil {
+				return response, err
+			}
+			fields, err := rc.dec.DecodeFull(block)
+			if err != nil {
+				return response, err
+			}
+			if f.StreamID == id {
+				if response == nil {
+					response = fields
+				}
+				for _, s := range stats {
+					if err := s.add(block); err != nil {
+						return response, err
+					}
+					s.addRaw(fields)
+				}
+			}
+			if f.StreamID == id && f.StreamEnded() {
+				return response, nil
+			}
+		case *http2.DataFrame:
+			if f.StreamID == id && f.StreamEnded() {
+				return response, nil
+			}
+		case *http2.RSTStreamFrame:
+			if f.StreamID == id {
+				return response, errors.New("stream reset: " + f.ErrCode.String())
+			}
+		case *http2.GoAwayFrame:
+			return response, errors.New("GOAWAY received: " + f.ErrCode.String())
+		}
+	}
+}
+
+// Read frames until the response headers for the given stream have been
+// received, and return them
+func readUntilHeaders(rc *rawConn, id uint32) ([]hpack.HeaderField, error) {
+	for {
+		f, err := rc.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch f := f.(type) {
+		case *http2.HeadersFrame:
+			block, err := rc.readHeaderBlock(f.HeaderBlockFragment(), f.HeadersEnded())
+			if err != nil {
+				return nil, err
+			}
+			fields, err := rc.dec.DecodeFull(block)
+			if err != nil {
+				return nil, err
+			}
+			if f.StreamID == id {
+				return fields, nil
+			}
+		case *http2.RSTStreamFrame:
+			if f.StreamID == id {
+				return nil, errors.New("stream reset: " + f.ErrCode.String())
+			}
+		case *http2.GoAwayFrame:
+			return nil, errors.New("GOAWAY received: " + f.ErrCode.String())
+		}
+	}
+}
+
+// Return the value of the given header field, or an empty string
+func headerValue(fields []hpack.HeaderField, name string) string {
+	for _, hf := range fields {
+		if hf.Name == name {
+			return hf.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/xyproto/vt"
+)
+
+// record is the outcome of checking one target, for writing reports
+type record struct {
+	Method     string       `json:"method"`
+	SNI        string       `json:"sni,omitempty"`       // the SNI name that was sent instead of the host, if any
+	NoSNI      bool         `json:"no_sni,omitempty"`    // true if no SNI was sent
+	Authority  string       `json:"authority,omitempty"` // the Host/:authority that was used instead of the host, if any
+	Result     *checkResult `json:"result"`
+	Assertions []assertion  `json:"assertions,omitempty"`
+}
+
+// Create a record for the given result, with the SNI name and Host/:authority
+// overrides that are currently in use
+func newRecord(method string, r *checkResult, assertions []assertion) *record {
+	return &record{Method: method, SNI: sniName, NoSNI: noSNI, Authority: hostHeader, Result: r, Assertions: assertions}
+}
+
+// Return the name of the record, for example "GET https://example.com", with
+// the SNI name and Host/:authority overrides in parenthesis, if there are any
+func (rec *record) name() string {
+	name := rec.Method + " " + rec.Result.URL
+	var overrides []string
+	if rec.NoSNI {
+		overrides = append(overrides, "no SNI")
+	} else if rec.SNI != "" {
+		overrides = append(overrides, "SNI "+rec.SNI)
+	}
+	if rec.Authority != "" {
+		overrides = append(overrides, "authority "+rec.Authority)
+	}
+	if len(overrides) > 0 {
+		name += " (" + strings.Join(overrides, ", ") + ")"
+	}
+	return name
+}
+
+// reportFiles are the files that the records should be written to, if any
+type reportFiles struct {
+	junit  string
+	report string // "html:FILE", "md:FILE" or a filename ending with .html or .md
+	json   string
+	har    string
+}
+
+// Write the records to all the report files that have been asked for
+func (rf *reportFiles) write(o *vt.TextOutput, records []*record) {
+	if rf.junit != "" {
+		if err := writeJUnit(rf.junit, records); err != nil {
+			o.ErrExit(err.Error())
+		}
+	}
+	if rf.report != "" {
+		format, filename, err := parseReportFlag(rf.report)
+		if err != nil {
+			o.ErrExit(err.Error())
+		}
+		if err := writeReport(format, filename, records); err != nil {
+			o.ErrExit(err.Error())
+		}
+	}
+	if rf.json != "" {
+		if err := writeJSON(rf.json, records); err != nil {
+			o.ErrExit(err.Error())
+		}
+	}
+	if rf.har != "" {
+		if err := writeHAR(rf.har, records); err != nil {
+			o.ErrExit(err.Error())
+		}
+	}
+}
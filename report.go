@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Report formats
+const (
+	reportHTML     = "html"
+	reportMarkdown = "md"
+)
+
+// Colors for the HTML reports, mirroring the terminal colors
+const (
+	colorGreen  = "#55dd55" // vt.LightGreen
+	colorYellow = "#e0c000" // vt.LightYellow
+	colorRed    = "#dd3333" // vt.Red
+	colorGray   = "#888888" // vt.DarkGray
+)
+
+// reportRow is one target, prepared for being written to a report
+type reportRow struct {
+	Target     string
+	Proto      string
+	Status     string
+	TLSVersion string
+	CertExpiry string
+	Latency    string
+	Outcome    string // "passed", "failed" or the error class
+	Color      string // the color of the outcome
+	Mark       string // a colored symbol for the outcome, for Markdown
+	Error      string
+	Timings    []reportTiming
+	Assertions []assertion
+}
+
+// reportTiming is the duration of one phase of a check
+type reportTiming struct {
+	Phase    string
+	Duration string
+}
+
+// Return true if the check succeeded and all the assertions passed
+func (rec *record) passed() bool {
+	if !rec.Result.ok() {
+		return false
+	}
+	for _, a := range rec.Assertions {
+		if !a.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// Prepare a record for being written to a report
+func newReportRow(rec *record) reportRow {
+	r := rec.Result
+	row := reportRow{
+		Target:     rec.name(),
+		Proto:      r.Proto,
+		Status:     r.Status,
+		TLSVersion: r.TLSVersion,
+		Latency:    r.Timings.Total.Round(time.Millisecond).String(),
+		Assertions: rec.Assertions,
+		Timings: []reportTiming{
+			{"DNS", r.Timings.DNS.String()},
+			{"Connect", r.Timings.Connect.String()},
+			{"TLS", r.Timings.TLS.String()},
+			{"Processing", r.Timings.Processing.String()},
+			{"Total", r.Timings.Total.String()},
+		},
+	}
+	if !r.CertExpiry.IsZero() {
+		row.CertExpiry = r.CertExpiry.Format("2006-01-02")
+	}
+	switch {
+	case !r.ok():
+		row.Outcome, row.Color, row.Mark = r.Class, colorRed, "🔴"
+		row.Error = r.summary()
+	case !rec.passed():
+		row.Outcome, row.Color, row.Mark = "failed", colorYellow, "🟡"
+	default:
+		row.Outcome, row.Color, row.Mark = "passed", colorGreen, "🟢"
+	}
+	return row
+}
+
+// The template for HTML reports
+var htmlReport = template.Must(template.New("report").Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; }
+th { background: #f0f0f0; }
+.gray { color: ` + colorGray + `; }
+.ok { color: ` + colorGreen + `; }
+.fail { color: ` + colorRed + `; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="gray">Generated {{.Generated}}</p>
+<h2>Summary</h2>
+<table>
+<tr><th>Target</th><th>Protocol</th><th>Status</th><th>TLS</th><th>Certificate expiry</th><th>Latency</th><th>Outcome</th></tr>
+{{- range .Rows}}
+<tr><td>{{.Target}}</td><td>{{.Proto}}</td><td>{{.Status}}</td><td>{{.TLSVersion}}</td><td>{{.CertExpiry}}</td><td>{{.Latency}}</td><td style="color: {{.Color}}">{{.Outcome}}</td></tr>
+{{- end}}
+</table>
+{{- range .Rows}}
+<h2>{{.Target}}</h2>
+{{- if .Error}}
+<p class="fail">{{.Error}}</p>
+{{- end}}
+<table>
+{{- range .Timings}}
+<tr><th>{{.Phase}}</th><td>{{.Duration}}</td></tr>
+{{- end}}
+</table>
+{{- if .Assertions}}
+<table>
+<tr><th>Expectation</th><th>Expected</th><th>Actual</th></tr>
+{{- range .Assertions}}
+<tr><td>{{.Name}}</td><td>{{.Expected}}</td><td class="{{if .OK}}ok{{else}}fail{{end}}">{{.Actual}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// Escape a value for use in a Markdown table cell
+func mdCell(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// Render the rows as Markdown
+func markdownReport(title, generated string, rows []reportRow) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\nGenerated %s\n\n## Summary\n\n", title, generated)
+	sb.WriteString("| Target | Protocol | Status | TLS | Certificate expiry | Latency | Outcome |\n")
+	sb.WriteString("|--------|----------|--------|-----|--------------------|---------|---------|\n")
+	for _, row := range rows {
+		fmt.Fprintf(&sb, "| %s | %s | %s | %s | %s | %s | %s %s |\n", mdCell(row.Target), mdCell(row.Proto), mdCell(row.Status), mdCell(row.TLSVersion), mdCell(row.CertExpiry), mdCell(row.Latency), row.Mark, row.Outcome)
+	}
+	for _, row := range rows {
+		fmt.Fprintf(&sb, "\n## %s\n\n", row.Target)
+		if row.Error != "" {
+			fmt.Fprintf(&sb, "🔴 %s\n\n", row.Error)
+		}
+		sb.WriteString("| Phase | Duration |\n|-------|----------|\n")
+		for _, t := range row.Timings {
+			fmt.Fprintf(&sb, "| %s | %s |\n", t.Phase, t.Duration)
+		}
+		if len(row.Assertions) > 0 {
+			sb.WriteString("\n| Expectation | Expected | Actual |\n|-------------|----------|--------|\n")
+			for _, a := range row.Assertions {
+				mark := "🟢"
+				if !a.OK {
+					mark = "🔴"
+				}
+				fmt.Fprintf(&sb, "| %s | %s | %s %s |\n", a.Name, mdCell(a.Expected), mark, mdCell(a.Actual))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// Split a --report value into a format and a filename. The format can be
+// given as a prefix, like "md:out.txt", or it is taken from the extension.
+func parseReportFlag(s string) (format, filename string, err error) {
+	if f, name, found := strings.Cut(s, ":"); found && (f == reportHTML || f == reportMarkdown) {
+		return f, name, nil
+	}
+	switch strings.ToLower(filepath.Ext(s)) {
+	case ".html", ".htm":
+		return reportHTML, s, nil
+	case ".md", ".markdown":
+		return reportMarkdown, s, nil
+	}
+	return "", "", fmt.Errorf("unknown report format for %s, use html:%s or md:%s", s, s, s)
+}
+
+// Write an HTML or Markdown report with a summary table and one section per target
+func writeReport(format, filename string, records []*record) error {
+	title := "http2check report"
+	generated := time.Now().Format("2006-01-02 15:04:05")
+	var rows []reportRow
+	for _, rec := range records {
+		rows = append(rows, newReportRow(rec))
+	}
+	if format == reportMarkdown {
+		return os.WriteFile(filename, []byte(markdownReport(title, generated, rows)), 0644)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return htmlReport.Execute(f, struct {
+		Title, Generated string
+		Rows             []reportRow
+	}{title, generated, rows})
+}
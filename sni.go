@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	neturl "net/url"
+	"strings"
+
+	"github.com/xyproto/vt"
+)
+
+// Split a comma separated list, leaving out empty entries
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// Check the URL once for every combination of SNI name and Host/:authority,
+// and print which certificate and protocol the server selects for each.
+// An empty SNI name means that no SNI is sent. The expectations are evaluated
+// for each combination. Returns the records and the exit code of the first
+// combination that failed, if any.
+func runOverrides(o *vt.TextOutput, url string, snis, hosts []string, expect expectations) ([]*record, int) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	if len(snis) == 0 {
+		snis = []string{u.Hostname()}
+	}
+	if len(hosts) == 0 {
+		hosts = []string{u.Host}
+	}
+
+	o.Println(vt.DarkGray.Get("GET") + " " + vt.LightCyan.Get(url) + " " + vt.DarkGray.Get(fmt.Sprintf("(%d combinations)", len(snis)*len(hosts))))
+	row := func(sni, authority, cert, proto string) string {
+		return fmt.Sprintf("%-24s %-24s %-40s %s", sni, authority, cert, proto)
+	}
+	o.Println()
+	o.Println(vt.DarkGray.Get(row("SNI", "authority", "certificate", "protocol")))
+
+	var records []*record
+	code := exitOK
+	for _, sni := range snis {
+		for _, host := range hosts {
+			sniName, noSNI, hostHeader = sni, sni == "", host
+			ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+			r := check(ctx, url)
+			cancel()
+			rec := newRecord("GET", r, expect.evaluate(r))
+			records = append(records, rec)
+
+			shownSNI := sni
+			if sni == "" {
+				shownSNI = "(none)"
+			}
+			cert := "-"
+			if r.CertName != "" {
+				cert = fmt.Sprintf("%s (%.8s)", r.CertName, r.CertSHA256)
+			}
+			var proto string
+			switch {
+			case r.ok() && r.Proto == "HTTP/2.0":
+				proto = vt.LightGreen.Get(r.Proto) + " " + r.Status
+			case r.ok():
+				proto = vt.LightYellow.Get(r.Proto) + " " + r.Status
+			default:
+				proto = vt.Red.Get(r.summary())
+			}
+			for _, a := range rec.Assertions {
+				if !a.OK && r.ok() {
+					proto += " " + vt.Red.Get("expected "+a.Name+" "+a.Expected)
+				}
+			}
+			o.Println(row(shownSNI, host, cert, proto))
+			if c := exitCode(r, rec.passed()); c != exitOK && code == exitOK {
+				code = c
+			}
+		}
+	}
+	return records, code
+}
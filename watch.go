@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/xyproto/vt"
+)
+
+// Return true if the result is what a healthy HTTP/2 server should give
+func (r *checkResult) passing() bool {
+	return r.ok() && r.Proto == "HTTP/2.0" && r.StatusCode < 400
+}
+
+// Return a string that only changes when the outcome of the check changes
+func (r *checkResult) outcome() string {
+	return r.Proto + "|" + r.Status + "|" + r.TLSVersion + "|" + r.Class
+}
+
+// watchStats keeps a running count of the checks done in watch mode
+type watchStats struct {
+	start    time.Time
+	checks   int
+	failures int
+}
+
+// Return the running uptime and failure count
+func (w *watchStats) String() string {
+	uptime := 100 * float64(w.checks-w.failures) / float64(w.checks)
+	return fmt.Sprintf("%.1f%% up, %d of %d checks failed, watching for %s", uptime, w.failures, w.checks, time.Since(w.start).Round(time.Second))
+}
+
+// Check the given URL at every interval, and only print something when the
+// outcome changes. If exitOnRegression is true, exit with a non-zero exit
+// code as soon as a passing check starts failing.
+func runWatch(o *vt.TextOutput, url string, interval time.Duration, exitOnRegression bool) {
+	o.Println(vt.DarkGray.Get("WATCH") + " " + vt.LightCyan.Get(url) + " " + vt.DarkGray.Get(fmt.Sprintf("(every %s)", interval)))
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	stats := &watchStats{start: time.Now()}
+	var previous *checkResult
+	for {
+		// A check that hangs must not hold up the checks that come after it.
+		// Checks that take longer than the interval delay the next tick.
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+		r := check(ctx, url)
+		cancel()
+		stats.checks++
+		if !r.passing() {
+			stats.failures++
+		}
+		if previous == nil || r.outcome() != previous.outcome() {
+			color := vt.LightGreen
+			if !r.passing() {
+				color = vt.Red
+			}
+			msg(o, time.Now().Format("15:04:05"), color.Get(r.summary()), stats.String())
+			if exitOnRegression && previous != nil && previous.passing() && !r.passing() {
+				os.Exit(1)
+			}
+		}
+		previous = r
+
+		select {
+		case <-ticker.C:
+		case <-interrupt:
+			o.Println()
+			msg(o, "summary", vt.White.Get(stats.String()))
+			if stats.failures > 0 {
+				os.Exit(1)
+			}
+			return
+		}
+	}
+}
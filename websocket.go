@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"os"
+	"time"
+
+	"github.com/xyproto/vt"
+	"golang.org/x/net/http2"
+)
+
+// How long to wait for a WebSocket message to be echoed back
+const echoTimeout = 5 * time.Second
+
+// WebSocket opcodes, from RFC 6455
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+)
+
+// websocketResult is the outcome of a WebSocket over HTTP/2 check
+type websocketResult struct {
+	connectProtocol bool   // true if the server sent SETTINGS_ENABLE_CONNECT_PROTOCOL=1
+	status          string // the :status of the extended CONNECT response
+	echoed          bool   // true if the test message was echoed back
+	echoErr         error  // why the echo did not work, if it did not
+}
+
+// Create a masked client to server WebSocket frame with the given opcode and payload
+func wsFrame(opcode byte, payload []byte) []byte {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	var mask [4]byte
+	rand.Read(mask[:])
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// Parse a WebSocket frame from the start of b. Returns the opcode, the
+// payload and true if b held a complete frame.
+func parseWSFrame(b []byte) (byte, []byte, bool) {
+	if len(b) < 2 {
+		return 0, nil, false
+	}
+	opcode := b[0] & 0x0f
+	masked := b[1]&0x80 != 0
+	n := uint64(b[1] & 0x7f)
+	pos := 2
+	switch n {
+	case 126:
+		if len(b) < 4 {
+			return 0, nil, false
+		}
+		n = uint64(binary.BigEndian.Uint16(b[2:]))
+		pos = 4
+	case 127:
+		if len(b) < 10 {
+			return 0, nil, false
+		}
+		n = binary.BigEndian.Uint64(b[2:])
+		pos = 10
+	}
+	var mask []byte
+	if masked {
+		if len(b) < pos+4 {
+			return 0, nil, false
+		}
+		mask = b[pos : pos+4]
+		pos += 4
+	}
+	if uint64(len(b)-pos) < n {
+		return 0, nil, false
+	}
+	payload := append([]byte(nil), b[pos:pos+int(n)]...)
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return opcode, payload, true
+}
+
+// Open a WebSocket over HTTP/2 with an extended CONNECT request (RFC 8441)
+// and check if a text message is echoed back
+func probeWebSocket(url string) (*websocketResult, error) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := dialRaw(url)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	// The server must allow extended CONNECT before it can be used
+	if err := rc.readSettings(); err != nil {
+		return nil, err
+	}
+	result := &websocketResult{connectProtocol: rc.settings[http2.SettingEnableConnectProtocol] == 1}
+	if !result.connectProtocol {
+		return result, nil
+	}
+
+	id, err := rc.request("CONNECT", u.RequestURI(), false, ":protocol", "websocket", "sec-websocket-version", "13")
+	if err != nil {
+		return result, err
+	}
+	fields, err := readUntilHeaders(rc, id)
+	if err != nil {
+		return result, err
+	}
+	result.status = headerValue(fields, ":status")
+	if result.status != "200" {
+		return result, nil
+	}
+
+	message := []byte(versionString + " echo test")
+	if err := rc.fr.WriteData(id, false, wsFrame(wsOpText, message)); err != nil {
+		return result, err
+	}
+	rc.conn.SetDeadline(time.Now().Add(echoTimeout))
+	var received []byte
+	for !result.echoed && result.echoErr == nil {
+		f, err := rc.readFrame()
+		if err != nil {
+			result.echoErr = err
+			break
+		}
+		switch f := f.(type) {
+		case *http2.DataFrame:
+			if f.StreamID != id {
+				continue
+			}
+			received = append(received, f.Data()...)
+			opcode, payload, ok := parseWSFrame(received)
+			switch {
+			case ok && opcode == wsOpText && bytes.Equal(payload, message):
+				result.echoed = true
+			case ok:
+				result.echoErr = fmt.Errorf("got opcode %d with %d bytes instead of the echo", opcode, len(payload))
+			case f.StreamEnded():
+				result.echoErr = errors.New("the stream ended before the echo")
+			}
+		case *http2.RSTStreamFrame:
+			if f.StreamID == id {
+				result.echoErr = errors.New("stream reset: " + f.ErrCode.String())
+			}
+		case *http2.GoAwayFrame:
+			result.echoErr = errors.New("GOAWAY received: " + f.ErrCode.String())
+		}
+	}
+
+	// Close the WebSocket and the stream
+	rc.fr.WriteData(id, true, wsFrame(wsOpClose, nil))
+	return result, nil
+}
+
+// Check if WebSockets over HTTP/2 are supported, and print the results
+func runWebSocket(o *vt.TextOutput, url string) {
+	o.Println(vt.DarkGray.Get("CONNECT") + " " + vt.LightCyan.Get(url) + " " + vt.DarkGray.Get("(:protocol websocket)"))
+	result, err := probeWebSocket(url)
+	if err != nil {
+		o.ErrExit(err.Error())
+	}
+	if !result.connectProtocol {
+		msg(o, "setting", vt.Red.Get("SETTINGS_ENABLE_CONNECT_PROTOCOL not enabled"))
+		os.Exit(1)
+	}
+	msg(o, "setting", vt.LightGreen.Get("SETTINGS_ENABLE_CONNECT_PROTOCOL = 1"))
+	if result.status != "200" {
+		msg(o, "status", vt.Red.Get(result.status))
+		os.Exit(1)
+	}
+	msg(o, "status", vt.White.Get(result.status))
+	if result.echoed {
+		msg(o, "echo", vt.LightGreen.Get("Round trip OK"))
+	} else {
+		msg(o, "echo", vt.LightYellow.Get("No echo"), result.echoErr.Error())
+	}
+}